@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/git"
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+)
+
+func affected() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "affected [--targets packages] [--since rev | < changed-files]",
+		Short: "List the packages affected by changed files",
+		Long: `List the packages affected by changed files.
+
+Changed files are read from stdin, one per line. Relative paths are relative to the root of
+the enclosing git repository, as git prints them (such as with 'git diff --name-only'), or
+to the working directory outside of a git repository. Each target package that depends on
+a changed file is printed, one per line. Targets are given as directory patterns, such as
+./cmd/... (see 'go help packages'), and default to every package in the main modules.
+
+With --since, changed files are found with the local git repository instead: every file
+that changed since the current branch diverged from rev, including staged, unstaged and
+untracked changes. rev is not fetched, so it must be known locally (such as origin/main).
+
+A changed file that no longer exists affects the packages that depend on its directory.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	targets := cmd.Flags().StringSlice("targets", nil, "the packages that might be affected")
+	includeTest := cmd.Flags().Bool("test", false,
+		"list packages whose tests are affected, considering their test files and test imports")
+	since := cmd.Flags().String("since", "",
+		"find changed files with git, since the current branch diverged from this revision")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		var changed []string
+		if *since != "" {
+			changed, err = git.ChangedFiles(ctx, ".", *since)
+		} else {
+			changed, err = readChangedFiles(ctx, cmd.InOrStdin())
+		}
+		if err != nil {
+			return err
+		}
+		changed = withDeletedDirs(changed)
+
+		goWork := os.Getenv("GOWORK") != "off"
+		patterns := *targets
+		if len(patterns) == 0 {
+			dirs, err := modulefiles.MainModules(ctx, ".", goWork)
+			if err != nil {
+				return err
+			}
+			for _, dir := range dirs {
+				patterns = append(patterns, filepath.Join(dir, "..."))
+			}
+		}
+		packages, err := modulefiles.MatchPackages(ctx, patterns, config)
+		if err != nil {
+			return err
+		}
+		roots := make([]string, len(packages))
+		for i, pkg := range packages {
+			roots[i] = pkg.Dir
+		}
+
+		graph, err := modulefiles.FindGraph(ctx, roots, *includeTest, true, goWork, config)
+		if err != nil {
+			return err
+		}
+		for _, root := range graph.Affected(changed, *includeTest) {
+			if _, err := fmt.Println(goPackagePath(ctx, graph.Packages[root].Dir)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// readChangedFiles reads a list of files, one per line, into absolute paths. Relative paths
+// are relative to the root of the git repository enclosing the working directory, or else
+// to the working directory.
+func readChangedFiles(ctx context.Context, r io.Reader) ([]string, error) {
+	var base string
+	var files []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !filepath.IsAbs(line) && base == "" {
+			// git is only run once a relative path is read.
+			top, err := git.Toplevel(ctx, ".")
+			if err != nil {
+				log.Debug(ctx, "reading changed files relative to the working directory",
+					log.Attr("error", err.Error()))
+				top = "."
+			}
+			if base, err = filepath.Abs(top); err != nil {
+				return nil, err
+			}
+		}
+		file := line
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(base, file)
+		}
+		files = append(files, filepath.Clean(file))
+	}
+	return files, scanner.Err()
+}
+
+// withDeletedDirs adds the directory of each file in files that no longer exists, so the
+// packages that the file was deleted from are affected.
+func withDeletedDirs(files []string) []string {
+	for _, file := range files {
+		if _, err := os.Lstat(file); errors.Is(err, fs.ErrNotExist) {
+			files = append(files, filepath.Dir(file))
+		}
+	}
+	return files
+}
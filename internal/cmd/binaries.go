@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/display"
+	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+)
+
+// binary is a main package, and the files it is built from.
+type binary struct {
+	// name is the file name of the binary.
+	name string
+	// pkg is the argument that names the package for the go command.
+	pkg string
+	// deps are the files the binary depends on, relative to the working directory.
+	deps []string
+}
+
+// findGraph finds the graph of the packages matched by patterns, including module files.
+// When there are no patterns, the package in the current directory is found.
+func findGraph(ctx context.Context, patterns []string, includeTest bool, config modulefiles.Config) (*modulefiles.Graph, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	packages, err := modulefiles.MatchPackages(ctx, patterns, config)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, len(packages))
+	for i, pkg := range packages {
+		dirs[i] = pkg.Dir
+	}
+	return modulefiles.FindGraph(ctx, dirs, includeTest, true, os.Getenv("GOWORK") != "off", config)
+}
+
+// findBinaries finds each main package matched by patterns, and the files it depends on.
+// When there are no patterns, every main package in the main modules is found.
+//
+// Binaries are named after the last element of their package directory, so two packages
+// with the same name (such as cmd/foo and tools/foo) are an error. Binaries share a
+// cache, so each package is only imported once.
+func findBinaries(ctx context.Context, patterns []string, config modulefiles.Config) ([]binary, error) {
+	goWork := os.Getenv("GOWORK") != "off"
+	if len(patterns) == 0 {
+		dirs, err := modulefiles.MainModules(ctx, ".", goWork)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			patterns = append(patterns, filepath.Join(dir, "..."))
+		}
+	}
+	packages, err := modulefiles.MatchPackages(ctx, patterns, config)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := modulefiles.NewCache(ctx, packages[0].Dir)
+	if err != nil {
+		return nil, err
+	}
+	var binaries []binary
+	byName := map[string]string{} // Package directories by binary name
+	for _, pkg := range packages {
+		if !pkg.IsCommand() {
+			continue
+		}
+		name := filepath.Base(pkg.Dir)
+		if config.GOOS == "windows" {
+			name += ".exe"
+		}
+		if other, ok := byName[name]; ok {
+			return nil, fmt.Errorf("packages %s and %s both build a binary named %s",
+				goPackagePath(ctx, other), goPackagePath(ctx, pkg.Dir), name)
+		}
+		byName[name] = pkg.Dir
+
+		paths, err := cache.Find(ctx, []string{pkg.Dir}, false, true, goWork, config)
+		if err != nil {
+			return nil, err
+		}
+		binaries = append(binaries, binary{
+			name: name,
+			pkg:  goPackageArg(ctx, pkg.Dir),
+			deps: relativeToWd(ctx, paths, config.ModCacheDir()),
+		})
+	}
+	return binaries, nil
+}
+
+// goPackageArg returns the argument that names the package in dir for the go command,
+// quoted for a shell.
+func goPackageArg(ctx context.Context, dir string) string {
+	return display.Escape([]string{goPackagePath(ctx, dir)}, display.EscapeShell)[0]
+}
+
+// goPackagePath returns the path that names the package in dir for the go command,
+// relative to the working directory when possible.
+func goPackagePath(ctx context.Context, dir string) string {
+	rel := relativeToWd(ctx, []string{dir})[0]
+	if rel == "." || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel
+	}
+	// The go command reads arguments without a leading "./" as import paths.
+	return "." + string(filepath.Separator) + rel
+}
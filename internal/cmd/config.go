@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+)
+
+// configFlags registers the flags that describe the build configuration on cmd.
+//
+// The returned function resolves the flags (and the environment they default to) into
+// a [modulefiles.Config]. It must only be called after the flags have been parsed.
+func configFlags(cmd *cobra.Command) func() (modulefiles.Config, error) {
+	tags := cmd.Flags().String("tags", "",
+		"a comma-separated list of build tags to consider satisfied (defaults to -tags in GOFLAGS)")
+	goos := cmd.Flags().String("goos", "", "the operating system to resolve packages for (defaults to $GOOS)")
+	goarch := cmd.Flags().String("goarch", "", "the architecture to resolve packages for (defaults to $GOARCH)")
+	goVersion := cmd.Flags().String("go-version", "",
+		"the version of the go toolchain that builds the package (defaults to the toolchain selected by GOTOOLCHAIN, go.work and go.mod)")
+	cgo := cmd.Flags().Bool("cgo", false, "resolve packages with cgo enabled (defaults to $CGO_ENABLED)")
+	vendor := cmd.Flags().Bool("vendor", false,
+		"resolve dependencies from the vendor directory (defaults to -mod in GOFLAGS, or the presence of a vendor directory)")
+	external := cmd.Flags().Bool("external", false,
+		"include files from modules in the module cache, instead of only local modules")
+	platforms := cmd.Flags().StringSlice("platforms", nil,
+		"resolve packages for each GOOS/GOARCH pair listed, reporting the union of the results")
+	allPlatforms := cmd.Flags().Bool("all-platforms", false,
+		"resolve packages for every platform listed by 'go tool dist list', reporting the union of the results")
+	cmd.MarkFlagsMutuallyExclusive("platforms", "all-platforms")
+	embedWarn := cmd.Flags().Bool("embed-warn", false,
+		"report go:embed patterns that the go command would reject as warnings instead of errors")
+
+	return func() (modulefiles.Config, error) {
+		var config modulefiles.Config
+
+		if cmd.Flags().Changed("tags") {
+			config.Tags = splitTags(*tags)
+		} else if v, ok := goFlag("tags"); ok {
+			config.Tags = splitTags(v)
+		}
+
+		config.GOOS = flagOrEnv(cmd, "goos", *goos, "GOOS")
+		config.GOARCH = flagOrEnv(cmd, "goarch", *goarch, "GOARCH")
+		config.GOARM = os.Getenv("GOARM")
+		config.GOAMD64 = os.Getenv("GOAMD64")
+
+		config.GoVersion = *goVersion
+		config.GOTOOLCHAIN = os.Getenv("GOTOOLCHAIN")
+
+		if cmd.Flags().Changed("cgo") {
+			config.CgoEnabled = cgo
+		} else if env := os.Getenv("CGO_ENABLED"); env == "0" || env == "1" {
+			enabled := env == "1"
+			config.CgoEnabled = &enabled
+		}
+
+		if cmd.Flags().Changed("vendor") {
+			config.Vendor = vendor
+		} else if mod, ok := goFlag("mod"); ok {
+			vendored := mod == "vendor"
+			config.Vendor = &vendored
+		}
+
+		config.External = *external
+		config.GOMODCACHE = os.Getenv("GOMODCACHE")
+		config.EmbedWarnings = *embedWarn
+
+		switch {
+		case *allPlatforms:
+			config.Platforms = modulefiles.KnownPlatforms()
+		case len(*platforms) > 0:
+			for _, p := range *platforms {
+				platform, err := modulefiles.ParsePlatform(p)
+				if err != nil {
+					return config, err
+				}
+				config.Platforms = append(config.Platforms, platform)
+			}
+		}
+
+		return config, nil
+	}
+}
+
+// flagOrEnv returns value if the flag name was set, otherwise it returns the value of the
+// environmental variable env.
+func flagOrEnv(cmd *cobra.Command, name, value, env string) string {
+	if cmd.Flags().Changed(name) {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// splitTags splits a -tags value into its component tags.
+//
+// The go command accepts both comma-separated and (legacy) space-separated lists.
+func splitTags(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+}
+
+// goFlag returns the value that GOFLAGS sets for the flag name.
+//
+// GOFLAGS is a space-separated list of -flag=value settings. Flags without a value are
+// reported with a value of "". When a flag is repeated, the last setting wins.
+func goFlag(name string) (string, bool) {
+	var (
+		value string
+		found bool
+	)
+	for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+		f = strings.TrimPrefix(strings.TrimPrefix(f, "-"), "-")
+		k, v, _ := strings.Cut(f, "=")
+		if k == name {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/display"
+	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+)
+
+func graph() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph [packages]",
+		Short: "Print the package import graph",
+		Long: `Print the package import graph.
+
+Each package is annotated with the root of its module, how it was resolved (such as through
+a replace directive or go.work) and the number of files it depends on. Only packages that
+helpmakego follows are included: the standard library and (without --external) non-local
+modules are not.`,
+		SilenceUsage: true,
+	}
+
+	format := cmd.Flags().String("format", "dot", "the output format: 'dot', 'mermaid' or 'json'")
+	collapse := cmd.Flags().Bool("collapse-modules", false, "collapse the packages of each module into a single node")
+	includeTest := cmd.Flags().Bool("test", false, "include test files, and the imports made by tests")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		packages, err := modulefiles.MatchPackages(ctx, args, config)
+		if err != nil {
+			return err
+		}
+		roots := make([]string, len(packages))
+		for i, pkg := range packages {
+			roots[i] = pkg.Dir
+		}
+
+		graph, err := modulefiles.FindGraph(ctx, roots, *includeTest, false, os.Getenv("GOWORK") != "off", config)
+		if err != nil {
+			return err
+		}
+
+		view := display.PackageGraph{
+			Roots: graph.Roots,
+			Nodes: []display.PackageNode{},
+			Edges: []display.PackageImport{},
+		}
+		for _, pkg := range graph.Packages {
+			node := display.PackageNode{
+				ImportPath: pkg.ImportPath,
+				Via:        string(pkg.Via),
+				Files:      len(pkg.Files),
+			}
+			if mod, ok := graph.Modules[pkg.Module]; ok {
+				node.Module = mod.Path
+				node.ModuleRoot = relativeToWd(ctx, []string{mod.Dir})[0]
+			}
+			view.Nodes = append(view.Nodes, node)
+			for _, imp := range pkg.Imports {
+				view.Edges = append(view.Edges, display.PackageImport{
+					From: pkg.ImportPath,
+					To:   imp.ImportPath,
+					Test: imp.Test,
+				})
+			}
+		}
+		slices.SortFunc(view.Nodes, func(a, b display.PackageNode) int {
+			return strings.Compare(a.ImportPath, b.ImportPath)
+		})
+		slices.SortFunc(view.Edges, func(a, b display.PackageImport) int {
+			if c := strings.Compare(a.From, b.From); c != 0 {
+				return c
+			}
+			return strings.Compare(a.To, b.To)
+		})
+		if *collapse {
+			view = view.CollapseModules()
+		}
+
+		var out []byte
+		switch *format {
+		case "dot":
+			out = view.Dot()
+		case "mermaid":
+			out = view.Mermaid()
+		case "json":
+			out, err = json.MarshalIndent(view, "", "  ")
+			if err != nil {
+				return err
+			}
+			out = append(out, '\n')
+		default:
+			return fmt.Errorf(`invalid format %q: valid options are "dot", "mermaid" and "json"`, *format)
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	return cmd
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/digest"
+	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+)
+
+func hash() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hash [packages]",
+		Short: "Print a digest of the dependencies of packages, for use as a cache key",
+		Long: `Print a digest of the dependencies of packages, for use as a cache key.
+
+The digest covers the content and path of every file the packages depend on, and the
+build configuration (GOOS, GOARCH, build tags, cgo and the Go version). Paths are relative
+to the main module, and files in the module cache are relative to $GOMODCACHE, so the
+digest is the same across machines and checkouts. The Go version is the one that go.work
+or go.mod asks for (or that --go-version or GOTOOLCHAIN sets), not that of the local
+toolchain.
+
+Packages are given as directory patterns, such as ./cmd/... (see 'go help packages'), and
+default to the package in the current directory.
+
+With --format=json, the configuration and the digest of each file are reported too, to
+debug cache misses.`,
+		SilenceUsage: true,
+	}
+
+	format := cmd.Flags().String("format", "text", "the output format: 'text' (the digest alone) or 'json'")
+	includeTest := cmd.Flags().Bool("test", false, "include test files in the dependency analysis")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		if *format != "text" && *format != "json" {
+			return fmt.Errorf(`invalid format %q: valid options are "text" and "json"`, *format)
+		}
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		graph, err := findGraph(ctx, args, *includeTest, config)
+		if err != nil {
+			return err
+		}
+		key := buildKey(graph, *includeTest)
+		files, err := hashFiles(graph, new(digest.Cache))
+		if err != nil {
+			return err
+		}
+		sum := digest.Sum(key, files)
+
+		if *format == "text" {
+			_, err := fmt.Println(sum)
+			return err
+		}
+		out, err := json.MarshalIndent(struct {
+			Digest string          `json:"digest"`
+			Config json.RawMessage `json:"config"`
+			Files  []digest.File   `json:"files"`
+		}{sum, key, files}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(out, '\n'))
+		return err
+	}
+
+	return cmd
+}
+
+// buildKey describes the configuration that graph was found under, as it contributes to
+// a digest. Settings that only describe the machine, such as GOMODCACHE and the version of
+// the local toolchain, are left out.
+func buildKey(graph *modulefiles.Graph, includeTest bool) []byte {
+	config := graph.Config
+	config.Tags = slices.Sorted(slices.Values(config.Tags))
+	config.GoVersion = graph.RequiredGoVersion
+	config.GOTOOLCHAIN = "" // Resolved into RequiredGoVersion
+	config.GOMODCACHE = ""
+	config.EmbedWarnings = false
+	config.Dirs = false
+	key, err := json.Marshal(struct {
+		modulefiles.Config
+		Test bool `json:"test,omitempty"`
+	}{config, includeTest})
+	if err != nil {
+		panic(err) // Config is always serializable
+	}
+	return key
+}
+
+// hashFiles hashes every file of graph with cache, in order.
+//
+// Files are named by their slash separated path relative to the main module, or relative
+// to $GOMODCACHE for files in the module cache, so names don't depend on where the
+// checkout is or where helpmakego runs from.
+func hashFiles(graph *modulefiles.Graph, cache *digest.Cache) ([]digest.File, error) {
+	paths := graph.AllFiles()
+	modCache := graph.Config.ModCacheDir()
+
+	files := make([]digest.File, len(paths))
+	for i, path := range paths {
+		hash, err := cache.Hash(path)
+		if err != nil {
+			return nil, err
+		}
+		name := path
+		if rel, ok := relativeTo(modCache, path); ok && graph.Config.External {
+			name = "$GOMODCACHE/" + filepath.ToSlash(rel)
+		} else if rel, err := filepath.Rel(graph.MainModule, path); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		files[i] = digest.File{Path: name, Hash: hash}
+	}
+	slices.SortFunc(files, func(a, b digest.File) int { return strings.Compare(a.Path, b.Path) })
+	return files, nil
+}
+
+// relativeTo returns path relative to dir, if path is within dir.
+func relativeTo(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/display"
+)
+
+func makefile() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "makefile [packages]",
+		Short: "Write a Makefile fragment with a target for each main package",
+		Long: `Write a Makefile fragment with a target for each main package.
+
+Packages are given as directory patterns, such as ./cmd/... (see 'go help packages'), and
+default to every package in the main modules. Each target builds its binary into
+--out-dir with --recipe, and depends on every file the package depends on. Binaries are
+named after their package directory, so two packages can't share a directory name.
+
+The recipe is a Go template, where {{.Package}} is the package to build and {{.Name}} is
+the name of the binary. Both are escaped for make, and {{.Package}} is quoted for the
+shell.`,
+		SilenceUsage: true,
+	}
+
+	outDir := cmd.Flags().String("out-dir", "bin", "the directory binaries are built into")
+	recipe := cmd.Flags().String("recipe", "go build -o $@ {{.Package}}", "the template of the recipe that builds each binary")
+	outFile := cmd.Flags().StringP("output", "o", "",
+		"write the fragment to this file instead of stdout, only rewriting it when its content changes")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		recipe, err := template.New("recipe").Option("missingkey=error").Parse(*recipe)
+		if err != nil {
+			return fmt.Errorf("invalid recipe: %w", err)
+		}
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		binaries, err := findBinaries(ctx, args, config)
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		b.WriteString("# Code generated by helpmakego. DO NOT EDIT.\n")
+		var allDeps []string
+		for _, bin := range binaries {
+			var lines strings.Builder
+			err := recipe.Execute(&lines, struct{ Package, Name string }{
+				display.MakeValue(bin.pkg), display.MakeValue(bin.name),
+			})
+			if err != nil {
+				return fmt.Errorf("invalid recipe: %w", err)
+			}
+			b.WriteString("\n")
+			b.Write(display.MakeRule(filepath.Join(*outDir, bin.name), bin.deps, strings.Split(lines.String(), "\n")))
+			allDeps = append(allDeps, bin.deps...)
+		}
+		slices.Sort(allDeps)
+		b.Write(display.MakeEmptyRules(slices.Compact(allDeps)))
+
+		if *outFile != "" {
+			return display.WriteFileIfChanged(*outFile, b.Bytes())
+		}
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+
+	return cmd
+}
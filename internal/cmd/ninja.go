@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/display"
+)
+
+func ninja() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ninja [packages]",
+		Short: "Write a build.ninja fragment with a build edge for each main package",
+		Long: `Write a build.ninja fragment with a build edge for each main package.
+
+Packages are given as directory patterns, such as ./cmd/... (see 'go help packages'), and
+default to every package in the main modules. Each edge builds its binary into --out-dir,
+and depends on every file the package depends on. Binaries are named after their package
+directory, so two packages can't share a directory name.`,
+		SilenceUsage: true,
+	}
+
+	outDir := cmd.Flags().String("out-dir", "bin", "the directory binaries are built into")
+	rule := cmd.Flags().String("rule", "go_build", "the name of the rule that builds binaries")
+	command := cmd.Flags().String("command", "go build -o $out $pkg",
+		"the command of the rule that builds binaries, where $pkg is the package to build (when empty, the rule must be defined elsewhere)")
+	outFile := cmd.Flags().StringP("output", "o", "",
+		"write the fragment to this file instead of stdout, only rewriting it when its content changes")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		binaries, err := findBinaries(ctx, args, config)
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		if *command != "" {
+			b.Write(display.NinjaRule(*rule,
+				display.NinjaVar{Name: "command", Value: *command},
+				display.NinjaVar{Name: "description", Value: "go build $pkg"},
+			))
+		}
+		for _, bin := range binaries {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			b.Write(display.NinjaBuild(filepath.Join(*outDir, bin.name), *rule, bin.deps,
+				display.NinjaVar{Name: "pkg", Value: display.NinjaValue(bin.pkg)},
+			))
+		}
+
+		if *outFile != "" {
+			return display.WriteFileIfChanged(*outFile, b.Bytes())
+		}
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+
+	return cmd
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/display"
+)
+
+// outputFlags registers the flags that control how the files a package depends on are
+// written.
+//
+// The returned function writes paths as described by the flags. It must only be called
+// after the flags have been parsed.
+func outputFlags(cmd *cobra.Command) func(ctx context.Context, paths []string) error {
+	outputJSON := cmd.Flags().Bool("json", false, "output source files as a a JSON array (shorthand for --format=json)")
+	format := cmd.Flags().String("format", "plain",
+		"the output format: 'plain' (space separated), 'json', 'make-deps' (a make depfile, as with 'gcc -MD -MP') or 'ninja-dep' (a depfile for 'deps = gcc')")
+	depfile := cmd.Flags().String("depfile", "",
+		"write the output to this file instead of stdout, only rewriting it when its content changes (implies --format=make-deps)")
+	target := cmd.Flags().String("target", "",
+		"the target that depends on the package, for --format=make-deps and --format=ninja-dep")
+	escape := cmd.Flags().String("escape", string(display.EscapeMake),
+		"how paths are escaped in the plain output: 'make' (for $(shell ...) in a makefile), 'shell' or 'none'")
+	manifest := cmd.Flags().String("manifest", "",
+		"write the list of dependencies to this file, only rewriting it when the list changes, and add it as a dependency")
+	cmd.MarkFlagsMutuallyExclusive("json", "format")
+
+	return func(ctx context.Context, paths []string) error {
+		// The manifest changes when a dependency is added or removed, which the
+		// modification times of the dependencies alone don't show.
+		if *manifest != "" {
+			content := []byte(strings.Join(paths, "\n") + "\n")
+			if err := display.WriteFileIfChanged(*manifest, content); err != nil {
+				return err
+			}
+			paths = append(paths, *manifest)
+		}
+
+		format := *format
+		switch {
+		case *outputJSON:
+			format = "json"
+		case *depfile != "" && !cmd.Flags().Changed("format"):
+			format = "make-deps"
+		}
+
+		var out []byte
+		switch format {
+		case "plain":
+			escaping, err := display.ParseEscaping(*escape)
+			if err != nil {
+				return err
+			}
+			out = []byte(strings.Join(display.Escape(paths, escaping), " ") + "\n")
+		case "json":
+			var err error
+			out, err = json.Marshal(paths)
+			if err != nil {
+				return err
+			}
+			out = append(out, '\n')
+		case "make-deps":
+			if *target == "" {
+				return errors.New("--target is required for --format=make-deps")
+			}
+			out = display.MakeDepfile(*target, paths)
+		case "ninja-dep":
+			if *target == "" {
+				return errors.New("--target is required for --format=ninja-dep")
+			}
+			out = display.NinjaDepfile(*target, paths)
+		default:
+			return fmt.Errorf(`invalid format %q: valid options are "plain", "json", "make-deps" and "ninja-dep"`, format)
+		}
+
+		if *depfile != "" {
+			return display.WriteFileIfChanged(*depfile, out)
+		}
+		_, err := os.Stdout.Write(out)
+		return err
+	}
+}
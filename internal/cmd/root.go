@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
@@ -21,92 +20,127 @@ var useDaemon = isTruthy(os.Getenv("HELPMAKEGO_EXPERIMENT_DAEMON"))
 
 func Root() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:          "helpmakego [path-to-package] [--test] [--abs] [--mod]",
-		Short:        "Find all files a Go package depends on - suitable for Make",
+		Use:   "helpmakego [packages] [--test] [--abs] [--mod]",
+		Short: "Find all files a Go package depends on - suitable for Make",
+		Long: `Find all files a Go package depends on - suitable for Make.
+
+Packages are given as directory patterns, such as ./cmd/... (see 'go help packages'). When
+multiple packages are given, the files that any of them depend on are reported.`,
 		SilenceUsage: true,
-		Args:         cobra.MaximumNArgs(1),
+		Args:         cobra.ArbitraryArgs,
 	}
 
 	includeTest := cmd.Flags().Bool("test", false, "include test files in the dependency analysis")
-	outputJSON := cmd.Flags().Bool("json", false, "output source files as a a JSON array")
 	absolutePaths := cmd.Flags().Bool("abs", false, "output absolute paths instead of relative paths")
 	includeMod := cmd.Flags().Bool("mod", true, "include module files in the result")
+	externalAbs := cmd.Flags().Bool("external-abs", true,
+		"output absolute paths for files in the module cache, even when outputting relative paths")
+	includeDirs := cmd.Flags().Bool("dirs", false,
+		"include package directories and directories holding embedded files, so adding or removing a file changes a dependency")
+	config := configFlags(cmd)
+	output := outputFlags(cmd)
 
 	isDaemon := cmd.Flags().Bool("x-daemon", false, "do not run the normal process, run as a daemon")
 	cmd.Flag("x-daemon").Hidden = true
 
+	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		cmd.SetContext(withLogger(cmd.Context()))
+	}
+
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		ctx := cmd.Context()
 
-		var pkgPath string
-		if len(args) == 0 {
-			wd, err := os.Getwd()
+		// This should only be set by another invocation of helpmakego, and is not
+		// designed to be called by users.
+		if *isDaemon {
+			pkgPath := "."
+			if len(args) > 0 {
+				pkgPath = args[0]
+			}
+			pkgPath, err := filepath.Abs(pkgPath)
 			if err != nil {
 				return err
 			}
-			pkgPath = wd
-		} else {
-			pkgPath = args[0]
+			return daemon.Serve(ctx, pkgPath)
 		}
 
-		pkgPath, err := filepath.Abs(pkgPath)
-		if err != nil {
-			return err
+		find := modulefiles.Find
+		if useDaemon {
+			find = daemon.Find
 		}
 
-		setLevel := func(level slog.Level) context.Context {
-			return log.New(ctx, slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-				Level: level,
-			})))
+		config, err := config()
+		if err != nil {
+			return err
 		}
+		config.Dirs = *includeDirs
 
-		switch os.Getenv("LOG") {
-		case "debug":
-			ctx = setLevel(slog.LevelDebug)
-		case "error":
-			ctx = setLevel(slog.LevelError)
-		case "info":
-			ctx = setLevel(slog.LevelInfo)
-		case "", "warn":
-			ctx = setLevel(slog.LevelWarn)
-		default:
-			ctx = setLevel(slog.LevelWarn)
-			log.Warn(ctx, `invalid log level %q: valid options are "error", "warn", "info" and "debug"`)
+		if len(args) == 0 {
+			args = []string{"."}
 		}
-
-		// This should only be set by another invocation of helpmakego, and is not
-		// designed to be called by users.
-		if *isDaemon {
-			return daemon.Serve(ctx, pkgPath)
+		packages, err := modulefiles.MatchPackages(ctx, args, config)
+		if err != nil {
+			return err
 		}
-
-		find := modulefiles.Find
-		if useDaemon {
-			find = daemon.Find
+		pkgPaths := make([]string, len(packages))
+		for i, pkg := range packages {
+			pkgPaths[i] = pkg.Dir
 		}
 
-		paths, err := find(ctx, pkgPath, *includeTest, *includeMod, os.Getenv("GOWORK") != "off")
+		paths, err := find(ctx, pkgPaths, *includeTest, *includeMod, os.Getenv("GOWORK") != "off", config)
 		if err != nil {
 			return err
 		}
 
 		if !*absolutePaths {
-			if cwd, err := os.Getwd(); err == nil {
-				paths = display.Relative(ctx, cwd, paths)
-			} else {
-				log.Warn(ctx, "os.Getwd() failed - displaying absolute paths")
+			var keepAbsolute []string
+			if config.External && *externalAbs {
+				keepAbsolute = append(keepAbsolute, config.ModCacheDir())
 			}
+			paths = relativeToWd(ctx, paths, keepAbsolute...)
 		}
 
-		if *outputJSON {
-			err = json.NewEncoder(os.Stdout).Encode(paths)
-		} else {
-			_, err = fmt.Printf("%s\n", strings.Join(paths, " "))
-		}
-		return err
+		return output(ctx, paths)
 	}
 
+	cmd.AddCommand(ninja(), makefile(), why(), graph(), affected(), stamp(), hash(), stale(), execIfStale(), watchPackages())
+
 	return cmd
 }
 
+// relativeToWd displays paths relative to the working directory, except for those within
+// keepAbsolute.
+func relativeToWd(ctx context.Context, paths []string, keepAbsolute ...string) []string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Warn(ctx, "os.Getwd() failed - displaying absolute paths")
+		return paths
+	}
+	return display.Relative(ctx, cwd, paths, keepAbsolute...)
+}
+
+// withLogger equips ctx with a logger at the level set by $LOG.
+func withLogger(ctx context.Context) context.Context {
+	setLevel := func(level slog.Level) context.Context {
+		return log.New(ctx, slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: level,
+		})))
+	}
+
+	switch os.Getenv("LOG") {
+	case "debug":
+		return setLevel(slog.LevelDebug)
+	case "error":
+		return setLevel(slog.LevelError)
+	case "info":
+		return setLevel(slog.LevelInfo)
+	case "", "warn":
+		return setLevel(slog.LevelWarn)
+	default:
+		ctx = setLevel(slog.LevelWarn)
+		log.Warn(ctx, fmt.Sprintf(`invalid log level %q: valid options are "error", "warn", "info" and "debug"`, os.Getenv("LOG")))
+		return ctx
+	}
+}
+
 func isTruthy(s string) bool { return strings.EqualFold(s, "true") || s == "1" }
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+)
+
+// ExitError exits helpmakego with Code, after reporting Err if it is set.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+func stale() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stale --target file [packages]",
+		Short: "Check if a target is older than the files its packages depend on",
+		Long: `Check if a target is older than the files its packages depend on.
+
+stale exits 1 if the target is stale: it doesn't exist, or a file that the packages depend
+on was modified after it. Otherwise, stale exits 0. Errors exit 2. Like 'make -q', success
+means there is nothing to do:
+
+    helpmakego stale --target bin/server ./cmd/server || go build -o bin/server ./cmd/server
+
+Packages are given as directory patterns, such as ./cmd/... (see 'go help packages'), and
+default to the package in the current directory.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	target := cmd.Flags().String("target", "", "the file built from the packages")
+	verbose := cmd.Flags().BoolP("verbose", "v", false, "print why the target is stale")
+	includeTest := cmd.Flags().Bool("test", false, "include test files in the dependency analysis")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		config, err := config()
+		if err != nil {
+			return &ExitError{Code: 2, Err: err}
+		}
+		reasons, err := staleness(ctx, *target, args, *includeTest, config)
+		if err != nil {
+			return &ExitError{Code: 2, Err: err}
+		}
+		if len(reasons) == 0 {
+			return nil
+		}
+		if *verbose {
+			for _, reason := range reasons {
+				if _, err := fmt.Println(reason); err != nil {
+					return &ExitError{Code: 2, Err: err}
+				}
+			}
+		}
+		return &ExitError{Code: 1}
+	}
+
+	return cmd
+}
+
+func execIfStale() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec --target file [packages] -- command [args...]",
+		Short: "Run a command only if a target is older than the files its packages depend on",
+		Long: `Run a command only if a target is older than the files its packages depend on.
+
+The command runs when the target is stale (see 'helpmakego stale'), and helpmakego exits
+with its exit status. When the target is up to date, nothing runs and helpmakego exits 0.
+
+Packages are given as directory patterns, such as ./cmd/... (see 'go help packages'), and
+default to the package in the current directory.`,
+		SilenceUsage: true,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if dash := cmd.ArgsLenAtDash(); dash < 0 || dash == len(args) {
+				return errors.New("expected a command after --")
+			}
+			return nil
+		},
+	}
+
+	target := cmd.Flags().String("target", "", "the file built from the packages")
+	includeTest := cmd.Flags().Bool("test", false, "include test files in the dependency analysis")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		dash := cmd.ArgsLenAtDash()
+		reasons, err := staleness(ctx, *target, args[:dash], *includeTest, config)
+		if err != nil {
+			return err
+		}
+		if len(reasons) == 0 {
+			log.Info(ctx, "target is up to date", log.Attr("target", *target))
+			return nil
+		}
+		log.Info(ctx, "target is stale", log.Attr("target", *target), log.Attr("reason", reasons[0]))
+
+		run := exec.CommandContext(ctx, args[dash], args[dash+1:]...)
+		run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err = run.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			cmd.SilenceErrors = true
+			return &ExitError{Code: exitErr.ExitCode()}
+		}
+		return err
+	}
+
+	return cmd
+}
+
+// staleness explains why target is stale with respect to the packages matched by
+// patterns, or returns no reasons if target is up to date.
+//
+// target is stale if it doesn't exist, or if any file that the packages depend on was
+// modified after it. Each such file is a reason, relative to the working directory.
+func staleness(ctx context.Context, target string, patterns []string, includeTest bool, config modulefiles.Config) ([]string, error) {
+	if target == "" {
+		return nil, errors.New("--target is required")
+	}
+	graph, err := findGraph(ctx, patterns, includeTest, config)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return []string{target + " does not exist"}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var newer []string
+	for _, path := range graph.AllFiles() {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fileInfo.ModTime().After(info.ModTime()) {
+			newer = append(newer, path)
+		}
+	}
+	return relativeToWd(ctx, newer), nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/digest"
+	"github.com/iwahbe/helpmakego/internal/pkg/display"
+)
+
+func stamp() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stamp --out file [packages]",
+		Short: "Write a stamp file that changes only when the content of the dependencies changes",
+		Long: `Write a stamp file that changes only when the content of the dependencies changes.
+
+The stamp holds a digest of the content and path of every file the packages depend on. It
+is only rewritten when the digest changes, so a target that depends on the stamp instead
+of the files themselves isn't rebuilt when files are touched without being changed, such
+as by 'git checkout' or restoring a CI cache.
+
+Packages are given as directory patterns, such as ./cmd/... (see 'go help packages'), and
+default to the package in the current directory.
+
+The hashes of files are cached in --state, keyed by the path, size, modification time and
+inode of each file, so unchanged files are not read again.`,
+		SilenceUsage: true,
+	}
+
+	out := cmd.Flags().String("out", "", "the stamp file to write")
+	state := cmd.Flags().String("state", "", "the file that caches the hash of each file (defaults to the stamp file with a .hashes suffix)")
+	includeTest := cmd.Flags().Bool("test", false, "include test files in the dependency analysis")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		if *out == "" {
+			return errors.New("--out is required")
+		}
+		statePath := *state
+		if statePath == "" {
+			statePath = *out + ".hashes"
+		}
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		graph, err := findGraph(ctx, args, *includeTest, config)
+		if err != nil {
+			return err
+		}
+
+		hashes, err := digest.LoadCache(statePath)
+		if err != nil {
+			return err
+		}
+		var keepAbsolute []string
+		if config.External {
+			keepAbsolute = append(keepAbsolute, config.ModCacheDir())
+		}
+		paths := relativeToWd(ctx, graph.AllFiles(), keepAbsolute...)
+		files := make([]digest.File, len(paths))
+		for i, path := range paths {
+			hash, err := hashes.Hash(path)
+			if err != nil {
+				return err
+			}
+			files[i] = digest.File{Path: path, Hash: hash}
+		}
+		if data, ok := hashes.Bytes(); ok {
+			if err := display.WriteFileIfChanged(statePath, data); err != nil {
+				return err
+			}
+		}
+		return display.WriteFileIfChanged(*out, []byte(digest.Sum(nil, files)+"\n"))
+	}
+
+	return cmd
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+	"github.com/iwahbe/helpmakego/internal/pkg/watch"
+)
+
+func watchPackages() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch [packages] -- command [args...]",
+		Short: "Rerun a command whenever a file the packages depend on changes",
+		Long: `Rerun a command whenever a file the packages depend on changes.
+
+Only the files that the packages depend on are watched, along with the package directories
+and the directories holding embedded files, so adding a file to a package is noticed too.
+After each change the previous command is stopped (with its whole process group), the
+dependencies are found again and the command is rerun, so newly imported packages are
+watched as well.
+
+Packages are given as directory patterns, such as ./cmd/... (see 'go help packages'), and
+default to the package in the current directory. Watching is only supported on linux.`,
+		SilenceUsage: true,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if dash := cmd.ArgsLenAtDash(); dash < 0 || dash == len(args) {
+				return errors.New("expected a command after --")
+			}
+			return nil
+		},
+	}
+
+	debounce := cmd.Flags().Duration("debounce", 100*time.Millisecond,
+		"how long to wait for changes to settle before rerunning the command")
+	grace := cmd.Flags().Duration("grace", 5*time.Second,
+		"how long the command has to exit after SIGTERM, before it is killed")
+	includeTest := cmd.Flags().Bool("test", false, "include test files in the dependency analysis")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		dash := cmd.ArgsLenAtDash()
+		patterns, command := args[:dash], args[dash:]
+
+		watcher, err := watch.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = watcher.Close() }()
+
+		// The first set of dependencies must be found, but later failures (such as a
+		// syntax error while editing) only keep the previous set.
+		if err := watchDeps(ctx, watcher, patterns, *includeTest, config); err != nil {
+			return err
+		}
+
+		stderr := cmd.ErrOrStderr()
+		for {
+			proc, err := startProcess(command, stderr)
+			if err != nil {
+				return err
+			}
+
+			path, changed, err := waitForChange(ctx, watcher, proc, *debounce, stderr)
+			proc.stop(*grace)
+			if err != nil || !changed {
+				return err
+			}
+			if path == "" {
+				fmt.Fprintln(stderr, "helpmakego: files changed, restarting")
+			} else {
+				fmt.Fprintf(stderr, "helpmakego: %s changed, restarting\n", relativeToWd(ctx, []string{path})[0])
+			}
+
+			if err := watchDeps(ctx, watcher, patterns, *includeTest, config); err != nil {
+				log.Warn(ctx, fmt.Sprintf("could not find dependencies: %s", err))
+			}
+		}
+	}
+
+	return cmd
+}
+
+// watchDeps watches the dependencies of the packages matched by patterns.
+func watchDeps(ctx context.Context, watcher *watch.Watcher, patterns []string, includeTest bool, config modulefiles.Config) error {
+	graph, err := findGraph(ctx, patterns, includeTest, config)
+	if err != nil {
+		return err
+	}
+	files, dirs := graph.AllFiles(), graph.Dirs()
+	if err := watcher.Watch(files, dirs); err != nil {
+		// Files can be deleted between finding and watching them, which the next
+		// change fixes.
+		log.Warn(ctx, err.Error())
+	}
+	log.Info(ctx, "watching dependencies", log.Attr("files", len(files)), log.Attr("dirs", len(dirs)))
+	return nil
+}
+
+// waitForChange waits for a watched path to change, and then for changes to settle for
+// debounce. It returns the first path that changed (see [watch.Watcher.Events]), or false
+// if ctx is done first.
+func waitForChange(
+	ctx context.Context, watcher *watch.Watcher, proc *process, debounce time.Duration, stderr io.Writer,
+) (string, bool, error) {
+	var first string
+	var settled <-chan time.Time
+	exited := proc.done
+	for {
+		select {
+		case <-ctx.Done():
+			return "", false, nil
+		case <-exited:
+			exited = nil
+			if err := proc.err; err != nil {
+				fmt.Fprintf(stderr, "helpmakego: command failed: %s, waiting for changes\n", err)
+			} else {
+				fmt.Fprintln(stderr, "helpmakego: command finished, waiting for changes")
+			}
+		case path, ok := <-watcher.Events():
+			if !ok {
+				return "", false, errors.New("watcher stopped unexpectedly")
+			}
+			if settled == nil {
+				first = path
+			}
+			settled = time.After(debounce)
+		case <-settled:
+			return first, true, nil
+		}
+	}
+}
+
+// process is a command running in its own process group.
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error // Set once done is closed
+}
+
+// startProcess starts command in a new process group, so it can be stopped along with
+// any processes it starts (such as the binary run by 'go run').
+func startProcess(command []string, stderr io.Writer) (*process, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, stderr
+	newProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &process{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// stop stops the process group of p with SIGTERM, or SIGKILL if p doesn't exit within
+// grace.
+func (p *process) stop(grace time.Duration) {
+	// The process group can outlive its leader, so it is signaled even when p has
+	// already exited.
+	terminateProcessGroup(p.cmd.Process)
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+		killProcessGroup(p.cmd.Process)
+		<-p.done
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+)
+
+// newProcessGroup does nothing: process groups are only supported on unix.
+func newProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills proc, which can't be asked to exit on this platform.
+func terminateProcessGroup(proc *os.Process) {
+	_ = proc.Kill()
+}
+
+// killProcessGroup kills proc.
+func killProcessGroup(proc *os.Process) {
+	_ = proc.Kill()
+}
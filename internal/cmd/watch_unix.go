@@ -0,0 +1,24 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// newProcessGroup makes cmd start in a new process group, led by the process it starts.
+func newProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessGroup sends SIGTERM to the process group led by proc.
+func terminateProcessGroup(proc *os.Process) {
+	_ = syscall.Kill(-proc.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup sends SIGKILL to the process group led by proc.
+func killProcessGroup(proc *os.Process) {
+	_ = syscall.Kill(-proc.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+)
+
+func why() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "why [package] [file]",
+		Short: "Explain why a package depends on a file",
+		Long: `Explain why a package depends on a file.
+
+Prints the shortest chain of imports from the package to a package that depends on the
+file, noting imports resolved through a replace directive, a go.work use directive, the
+vendor directory or the module cache, and imports only made by tests.`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+	}
+
+	includeTest := cmd.Flags().Bool("test", false, "include test files in the dependency analysis")
+	config := configFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		config, err := config()
+		if err != nil {
+			return err
+		}
+		packages, err := modulefiles.MatchPackages(ctx, args[:1], config)
+		if err != nil {
+			return err
+		}
+		roots := make([]string, len(packages))
+		for i, pkg := range packages {
+			roots[i] = pkg.Dir
+		}
+		file, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+
+		graph, err := modulefiles.FindGraph(ctx, roots, *includeTest, true, os.Getenv("GOWORK") != "off", config)
+		if err != nil {
+			return err
+		}
+
+		display := func(path string) string { return relativeToWd(ctx, []string{path})[0] }
+		if slices.Contains(graph.Files, file) {
+			_, err := fmt.Printf("%s configures the build of every package\n", display(file))
+			return err
+		}
+		explanation, ok := graph.Why(file)
+		if !ok {
+			for _, mod := range graph.Modules {
+				if slices.Contains(mod.Files, file) {
+					_, err := fmt.Printf("%s describes %s, a main module\n", display(file), mod.Path)
+					return err
+				}
+			}
+			return fmt.Errorf("%s does not depend on %s", args[0], display(file))
+		}
+
+		var b strings.Builder
+		for i, step := range explanation.Chain {
+			var notes []string
+			if step.TestImport {
+				notes = append(notes, "test import")
+			}
+			switch step.Package.Via {
+			case modulefiles.ResolvedReplace:
+				notes = append(notes, "via replace => "+display(step.Package.Dir))
+			case modulefiles.ResolvedWorkspace:
+				notes = append(notes, "via go.work use => "+display(step.Package.Dir))
+			case modulefiles.ResolvedVendor:
+				notes = append(notes, "via vendor")
+			case modulefiles.ResolvedExternal:
+				notes = append(notes, "via module cache")
+			}
+			if i > 0 {
+				b.WriteString("  imports ")
+			}
+			b.WriteString(step.Package.ImportPath)
+			if len(notes) > 0 {
+				fmt.Fprintf(&b, " (%s)", strings.Join(notes, ", "))
+			}
+			b.WriteString("\n")
+		}
+
+		last := explanation.Chain[len(explanation.Chain)-1].Package
+		switch f := explanation.File; {
+		case explanation.Module != nil:
+			fmt.Fprintf(&b, "  in module %s, described by %s\n", explanation.Module.Path, display(file))
+		case f.Embed != "" && f.Test:
+			fmt.Fprintf(&b, "  test embeds %s (//go:embed %s)\n", display(file), f.Embed)
+		case f.Embed != "":
+			fmt.Fprintf(&b, "  embeds %s (//go:embed %s)\n", display(file), f.Embed)
+		case f.Test:
+			fmt.Fprintf(&b, "  test file %s\n", display(file))
+		case filepath.Dir(file) == last.Dir:
+			fmt.Fprintf(&b, "  source file %s\n", display(file))
+		default:
+			fmt.Fprintf(&b, "  includes %s\n", display(file))
+		}
+		_, err = fmt.Print(b.String())
+		return err
+	}
+
+	return cmd
+}
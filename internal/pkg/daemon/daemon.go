@@ -16,17 +16,33 @@ import (
 
 	"github.com/iwahbe/helpmakego/internal/pkg/log"
 	"github.com/iwahbe/helpmakego/internal/pkg/modulefiles"
+	"github.com/iwahbe/helpmakego/internal/pkg/watch"
 )
 
 const serverTimeout time.Duration = time.Second * 5
 
 // Serve a daemon to maintain the cache in the background.
 func Serve(ctx context.Context, pkgRoot string) error {
-	cache, err := modulefiles.NewCache(ctx, pkgRoot)
+	// Cached results are evicted when the files they were read from change. Paths are
+	// watched as the cache reads them, and changes are applied before each request.
+	s := &server{pending: func() []string { return nil }}
+	var err error
+	if watcher, werr := watch.NewWatcher(); werr == nil {
+		defer func() { _ = watcher.Close() }()
+		s.pending = watcher.Pending
+		s.cache, err = modulefiles.NewWatchedCache(ctx, pkgRoot, func(files, dirs []string) {
+			if err := watcher.Add(files, dirs); err != nil {
+				log.Debug(ctx, "failed to watch paths", log.Attr("error", err.Error()))
+			}
+		})
+	} else {
+		log.Warn(ctx, fmt.Sprintf("failed to watch files, results may be stale: %s", werr))
+		s.cache, err = modulefiles.NewCache(ctx, pkgRoot)
+	}
 	if err != nil {
 		return err
 	}
-	path := socketPath(cache.ModuleRoot())
+	path := socketPath(s.cache.ModuleRoot())
 
 	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
@@ -62,7 +78,7 @@ func Serve(ctx context.Context, pkgRoot string) error {
 		go func() {
 			defer wg.Done()
 			defer func() { _ = conn.Close() }()
-			handle(ctx, cache, conn)
+			handle(ctx, s, conn)
 		}()
 		if err := setDeadline(); err != nil {
 			return err
@@ -72,10 +88,7 @@ func Serve(ctx context.Context, pkgRoot string) error {
 
 func start(ctx context.Context, moduleRoot string) {
 	cmd := exec.CommandContext(context.WithoutCancel(ctx), os.Args[0], "--x-daemon", moduleRoot)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
-		Pgid:    0,
-	}
+	detach(cmd)
 	if err := cmd.Start(); err != nil {
 		log.Warn(ctx, fmt.Sprintf("failed to start daemon: %s", err))
 		return
@@ -93,8 +106,11 @@ func socketPath(moduleRoot string) string {
 
 // Find delegates a find call to the running daemon, or it executes the call locally and
 // while starting the daemon.
-func Find(ctx context.Context, pkgRoot string, includeTests, includeMod, goWork bool) ([]string, error) {
-	moduleRoot, err := modulefiles.FindModuleRoot(ctx, pkgRoot)
+func Find(ctx context.Context, pkgRoots []string, includeTests, includeMod, goWork bool, config modulefiles.Config) ([]string, error) {
+	if len(pkgRoots) == 0 {
+		return nil, errors.New("no packages to find")
+	}
+	moduleRoot, err := modulefiles.FindModuleRoot(ctx, pkgRoots[0])
 	if err != nil {
 		return nil, err
 	}
@@ -111,10 +127,10 @@ func Find(ctx context.Context, pkgRoot string, includeTests, includeMod, goWork
 	case errors.Is(err, os.ErrNotExist):
 		go start(ctx, moduleRoot) // Start the daemon in the background for the next invocation
 		log.Info(ctx, "starting daemon for next run")
-		return modulefiles.Find(ctx, pkgRoot, includeTests, includeMod, goWork)
+		return modulefiles.Find(ctx, pkgRoots, includeTests, includeMod, goWork, config)
 	case errors.Is(err, os.ErrPermission):
 		log.Warn(ctx, "permission denied to start daemon", log.Attr("error", err.Error()))
-		return modulefiles.Find(ctx, pkgRoot, includeTests, includeMod, goWork)
+		return modulefiles.Find(ctx, pkgRoots, includeTests, includeMod, goWork, config)
 	default:
 		return nil, fmt.Errorf("unexpected dial error for find daemon: %w", err)
 	}
@@ -122,9 +138,11 @@ func Find(ctx context.Context, pkgRoot string, includeTests, includeMod, goWork
 	enc := json.NewEncoder(conn)
 	enc.SetEscapeHTML(false)
 	err = enc.Encode(request{
-		PathToPackage: pkgRoot,
-		IncludeTest:   includeTests,
-		IncludeMod:    includeMod,
+		PathsToPackages: pkgRoots,
+		IncludeTest:     includeTests,
+		IncludeMod:      includeMod,
+		GoWork:          goWork,
+		Config:          config,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode request: %w", err)
@@ -141,7 +159,32 @@ func Find(ctx context.Context, pkgRoot string, includeTests, includeMod, goWork
 	return resp.Files, nil
 }
 
-func handle(ctx context.Context, cache modulefiles.Cache, conn net.Conn) {
+// server shares a cache between requests.
+type server struct {
+	cache modulefiles.Cache
+	// pending returns the paths changed since it was last called.
+	pending func() []string
+	// mu is held to read the cache, and held exclusively to invalidate it.
+	mu sync.RWMutex
+}
+
+// find serves req from the cache, once the changes made before req was received have been
+// applied to it.
+func (s *server) find(ctx context.Context, req request) ([]string, error) {
+	s.mu.Lock()
+	for _, path := range s.pending() {
+		log.Debug(ctx, "invalidating cache", log.Attr("path", path))
+		s.cache.Invalidate(path)
+	}
+	s.mu.Unlock()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cache.Find(ctx, req.PathsToPackages, req.IncludeTest, req.IncludeMod, req.GoWork, req.Config)
+}
+
+// handle serves a request from conn.
+func handle(ctx context.Context, s *server, conn net.Conn) {
 
 	// Read the request from the client CLI
 	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
@@ -158,7 +201,7 @@ func handle(ctx context.Context, cache modulefiles.Cache, conn net.Conn) {
 	}
 
 	// Execute find from the shared cache
-	files, err := cache.Find(ctx, req.PathToPackage, req.IncludeTest, req.IncludeMod, req.GoWork)
+	files, err := s.find(ctx, req)
 
 	// Write the response
 	enc := json.NewEncoder(conn)
@@ -177,10 +220,12 @@ func handle(ctx context.Context, cache modulefiles.Cache, conn net.Conn) {
 }
 
 type request struct {
-	PathToPackage string `json:"pathToPackage"`
-	IncludeTest   bool   `json:"includeTest"`
-	IncludeMod    bool   `json:"includeMod"`
-	GoWork        bool   `json:"goWork"`
+	PathsToPackages []string `json:"pathsToPackages"`
+	IncludeTest     bool     `json:"includeTest"`
+	IncludeMod      bool     `json:"includeMod"`
+	GoWork          bool     `json:"goWork"`
+
+	Config modulefiles.Config `json:"config"`
 }
 
 type response struct {
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package daemon
+
+import "os/exec"
+
+// detach does nothing: process groups are only supported on unix.
+func detach(cmd *exec.Cmd) {}
@@ -39,23 +39,10 @@ func TestDaemon(t *testing.T) {
 		serverDone <- err
 	}()
 
-	// Wait for daemon to start listening by polling for socket file
-	cache, err := modulefiles.NewCache(ctx, tmpDir)
-	require.NoError(t, err)
-	socketPath := socketPath(cache.ModuleRoot())
-
-	var socketExists bool
-	for range 50 { // Wait up to 5 seconds
-		if _, err := os.Stat(socketPath); err == nil {
-			socketExists = true
-			break
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-	require.True(t, socketExists, "daemon socket was not created: %s", socketPath)
+	waitForSocket(ctx, t, tmpDir)
 
 	// Test daemon.Find - should connect to running daemon
-	files, err := Find(ctx, tmpDir, false, true, true)
+	files, err := Find(ctx, []string{tmpDir}, false, true, true, modulefiles.Config{})
 	require.NoError(t, err)
 	require.NotEmpty(t, files)
 	assert.Equal(t, []string{
@@ -72,6 +59,102 @@ func TestDaemon(t *testing.T) {
 	}
 }
 
+func TestDaemonInvalidation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var logOut bytes.Buffer
+	ctx = log.New(ctx, slog.New(slog.NewTextHandler(&logOut, nil)))
+	defer func() { assert.NotContains(t, logOut.String(), "starting daemon for next run") }()
+
+	tmpDir := t.TempDir()
+	setupArtificialGoModule(t, tmpDir)
+	write := func(path, content string) {
+		t.Helper()
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	serverDone := make(chan error, 1)
+	go func() { serverDone <- Serve(context.Background(), tmpDir) }()
+	waitForSocket(ctx, t, tmpDir)
+
+	// expectFiles checks the files the daemon reports: changes made before a request are
+	// seen by it.
+	expectFiles := func(files ...string) {
+		t.Helper()
+		for i, f := range files {
+			files[i] = filepath.Join(tmpDir, f)
+		}
+		actual, err := Find(ctx, []string{tmpDir}, false, true, true, modulefiles.Config{})
+		require.NoError(t, err)
+		assert.Equal(t, files, actual)
+	}
+	expectFiles("go.mod", "main.go")
+
+	// A new import of a new package.
+	write("lib/lib.go", "package lib\n")
+	write("main.go", `package main
+
+import _ "test.example/foo/lib"
+
+func main() {}
+`)
+	expectFiles("go.mod", "lib/lib.go", "main.go")
+
+	// A new file in an imported package.
+	write("lib/extra.go", "package lib\n")
+	expectFiles("go.mod", "lib/extra.go", "lib/lib.go", "main.go")
+
+	// A new replace in go.mod.
+	write("other/go.mod", "module other.example\n\ngo 1.24\n")
+	write("other/other.go", "package other\n")
+	write("go.mod", `module test.example/foo
+
+go 1.24
+
+require other.example v0.0.0
+
+replace other.example => ./other
+`)
+	write("lib/lib.go", `package lib
+
+import _ "other.example"
+`)
+	expectFiles("go.mod", "lib/extra.go", "lib/lib.go", "main.go", "other/go.mod", "other/other.go")
+
+	// A removed file and a removed import.
+	require.NoError(t, os.Remove(filepath.Join(tmpDir, "lib", "extra.go")))
+	write("lib/lib.go", "package lib\n")
+	expectFiles("go.mod", "lib/lib.go", "main.go")
+
+	select {
+	case err := <-serverDone:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("daemon didn't shut down cleanly")
+	}
+}
+
+// waitForSocket waits for the daemon serving the module at dir to start listening.
+func waitForSocket(ctx context.Context, t *testing.T, dir string) {
+	t.Helper()
+	cache, err := modulefiles.NewCache(ctx, dir)
+	require.NoError(t, err)
+	socketPath := socketPath(cache.ModuleRoot())
+
+	var socketExists bool
+	for range 50 { // Wait up to 5 seconds
+		if _, err := os.Stat(socketPath); err == nil {
+			socketExists = true
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.True(t, socketExists, "daemon socket was not created: %s", socketPath)
+}
+
 func setupArtificialGoModule(t *testing.T, dir string) {
 	// Create go.mod
 	gomod := `module test.example/foo
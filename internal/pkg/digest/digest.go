@@ -0,0 +1,162 @@
+// Package digest hashes the content of files, so builds can be keyed on content instead of
+// modification times.
+package digest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// File is a file and the hash of its content.
+type File struct {
+	// Path is the path of the file, as it contributes to a [Sum].
+	Path string `json:"path"`
+	// Hash is the hex encoded SHA-256 of the content of the file.
+	Hash string `json:"hash"`
+}
+
+// Sum returns the hex encoded SHA-256 digest of config (a description of how files are
+// built) and files, in order. When config is nil, the digest covers files alone.
+//
+// The digest covers each path as well as each hash, so renaming, adding or removing a
+// file changes the digest even when no content changes.
+func Sum(config []byte, files []File) string {
+	h := sha256.New()
+	if config != nil {
+		_, _ = h.Write(config)
+		_, _ = h.Write([]byte{0})
+	}
+	for _, f := range files {
+		_, _ = io.WriteString(h, f.Path)
+		_, _ = h.Write([]byte{0})
+		_, _ = io.WriteString(h, f.Hash)
+		_, _ = h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recentWindow is how recently a file can have been modified for its hash to be cached.
+//
+// A file modified again within the resolution of its file system's timestamps keeps its
+// modification time, so its cached hash would go stale unnoticed.
+const recentWindow = 2 * time.Second
+
+// Cache caches the hashes of files by their path, size, modification time and inode, so
+// files that haven't changed aren't read again.
+//
+// The zero value is an empty cache.
+type Cache struct {
+	entries map[string]cacheEntry
+	// used holds the paths hashed since the cache was loaded.
+	used    map[string]struct{}
+	changed bool
+}
+
+type cacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // In nanoseconds since the Unix epoch
+	Inode   uint64 `json:"inode,omitempty"`
+	Hash    string `json:"hash"`
+}
+
+// LoadCache loads the cache saved at path by [Cache.Bytes]. A missing or unreadable cache
+// is empty: the cache can always be rebuilt by hashing files again.
+func LoadCache(path string) (*Cache, error) {
+	c := &Cache{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return c, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		c.entries = nil
+		c.changed = true
+	}
+	return c, nil
+}
+
+// Hash returns the hex encoded SHA-256 of the content of the file at path, from the cache
+// when the file hasn't changed since it was last hashed.
+func (c *Cache) Hash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := cacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Inode:   inode(info),
+	}
+	if c.used == nil {
+		c.used = map[string]struct{}{}
+	}
+	c.used[path] = struct{}{}
+
+	if e, ok := c.entries[path]; ok {
+		hash := e.Hash
+		e.Hash = ""
+		if e == key {
+			return hash, nil
+		}
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	if time.Since(info.ModTime()) < recentWindow {
+		if _, ok := c.entries[path]; ok {
+			delete(c.entries, path)
+			c.changed = true
+		}
+		return hash, nil
+	}
+	if c.entries == nil {
+		c.entries = map[string]cacheEntry{}
+	}
+	key.Hash = hash
+	c.entries[path] = key
+	c.changed = true
+	return hash, nil
+}
+
+// Bytes returns the serialized cache, holding the files hashed since it was loaded. It
+// reports false if the cache doesn't need to be saved again.
+func (c *Cache) Bytes() ([]byte, bool) {
+	for path := range c.entries {
+		if _, ok := c.used[path]; !ok {
+			delete(c.entries, path)
+			c.changed = true
+		}
+	}
+	if !c.changed {
+		return nil, false
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		panic(err) // Entries are always serializable
+	}
+	return data, true
+}
+
+// hashFile returns the hex encoded SHA-256 of the content of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
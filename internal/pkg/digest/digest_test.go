@@ -0,0 +1,102 @@
+package digest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSum(t *testing.T) {
+	t.Parallel()
+
+	config := []byte(`{"goos":"linux"}`)
+	files := []File{{Path: "a.go", Hash: "1"}, {Path: "b.go", Hash: "2"}}
+	sum := Sum(config, files)
+	assert.Equal(t, sum, Sum(config, []File{{Path: "a.go", Hash: "1"}, {Path: "b.go", Hash: "2"}}))
+	assert.NotEqual(t, sum, Sum(config, []File{{Path: "a.go", Hash: "1"}, {Path: "c.go", Hash: "2"}}))
+	assert.NotEqual(t, sum, Sum(config, []File{{Path: "a.go", Hash: "1"}, {Path: "b.go", Hash: "3"}}))
+	assert.NotEqual(t, sum, Sum(config, files[:1]))
+	assert.NotEqual(t, sum, Sum([]byte(`{"goos":"darwin"}`), files))
+	// Paths and hashes can't run together.
+	assert.NotEqual(t, Sum(nil, []File{{Path: "a", Hash: "b"}}), Sum(nil, []File{{Path: "ab", Hash: ""}}))
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	write := func(name, content string, modTime time.Time) string {
+		t.Helper()
+		path := filepath.Join(tmpDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+	a := write("a", "a", old)
+	b := write("b", "b", old)
+	recent := write("recent", "recent", time.Now())
+
+	var c Cache
+	hashA, err := c.Hash(a)
+	require.NoError(t, err)
+	assert.Equal(t, "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", hashA)
+	_, err = c.Hash(b)
+	require.NoError(t, err)
+	_, err = c.Hash(recent)
+	require.NoError(t, err)
+	_, err = c.Hash(filepath.Join(tmpDir, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	data, ok := c.Bytes()
+	require.True(t, ok)
+	state := filepath.Join(tmpDir, "state")
+	require.NoError(t, os.WriteFile(state, data, 0644))
+
+	loaded, err := LoadCache(state)
+	require.NoError(t, err)
+	assert.Contains(t, loaded.entries, a)
+	assert.Contains(t, loaded.entries, b)
+	// Recently modified files could change again without changing their modification time.
+	assert.NotContains(t, loaded.entries, recent)
+
+	// An unchanged file is hashed from the cache, so a doctored entry shows through.
+	e := loaded.entries[a]
+	e.Hash = "cached"
+	loaded.entries[a] = e
+	hash, err := loaded.Hash(a)
+	require.NoError(t, err)
+	assert.Equal(t, "cached", hash)
+
+	// A modified file is hashed again.
+	write("a", "A", old.Add(time.Minute))
+	hash, err = loaded.Hash(a)
+	require.NoError(t, err)
+	assert.NotEqual(t, "cached", hash)
+	assert.NotEqual(t, hashA, hash)
+
+	// Files that were not hashed since the cache was loaded are dropped.
+	data, ok = loaded.Bytes()
+	require.True(t, ok)
+	require.NoError(t, os.WriteFile(state, data, 0644))
+	loaded, err = LoadCache(state)
+	require.NoError(t, err)
+	assert.Contains(t, loaded.entries, a)
+	assert.NotContains(t, loaded.entries, b)
+
+	// Nothing changes when every file is hashed from the cache.
+	_, err = loaded.Hash(a)
+	require.NoError(t, err)
+	_, ok = loaded.Bytes()
+	assert.False(t, ok)
+
+	// A corrupt cache is empty.
+	require.NoError(t, os.WriteFile(state, []byte("not json"), 0644))
+	loaded, err = LoadCache(state)
+	require.NoError(t, err)
+	assert.Empty(t, loaded.entries)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package digest
+
+import "io/fs"
+
+// inode returns 0: inode numbers are only available on unix.
+func inode(fs.FileInfo) uint64 { return 0 }
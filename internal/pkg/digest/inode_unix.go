@@ -0,0 +1,16 @@
+//go:build unix
+
+package digest
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// inode returns the inode number of the file described by info.
+func inode(info fs.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
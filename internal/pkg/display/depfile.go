@@ -0,0 +1,99 @@
+package display
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MakeDepfile renders a make depfile in the style of `gcc -MD -MP`: target depends on each
+// of prerequisites, and each prerequisite has an empty rule so that make doesn't fail
+// when a prerequisite is deleted.
+func MakeDepfile(target string, prerequisites []string) []byte {
+	return append(MakeRule(target, prerequisites, nil), MakeEmptyRules(prerequisites)...)
+}
+
+// MakeRule renders a make rule: target depends on each of prerequisites, and is built by
+// each line of recipe.
+//
+// Recipe lines are written as is, so they can reference make variables. Use [MakeValue]
+// to include a literal value.
+func MakeRule(target string, prerequisites, recipe []string) []byte {
+	var b bytes.Buffer
+	b.WriteString(escapeMakefile(target))
+	b.WriteString(":")
+	for _, p := range prerequisites {
+		b.WriteString(" \\\n ")
+		b.WriteString(escapeMakefile(p))
+	}
+	b.WriteString("\n")
+	for _, line := range recipe {
+		b.WriteString("\t")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+// MakeValue escapes s so make passes it literally to the shell in a recipe.
+func MakeValue(s string) string { return strings.ReplaceAll(s, "$", "$$") }
+
+// MakeEmptyRules renders an empty rule for each of prerequisites, so make doesn't fail
+// when one of them is deleted.
+func MakeEmptyRules(prerequisites []string) []byte {
+	var b bytes.Buffer
+	for _, p := range prerequisites {
+		b.WriteString("\n")
+		b.WriteString(escapeMakefile(p))
+		b.WriteString(":\n")
+	}
+	return b.Bytes()
+}
+
+// escapeMakefile escapes path so make reads it as a single target or prerequisite, when
+// written in a makefile.
+func escapeMakefile(path string) string {
+	// Makefiles are expanded, so "$" must be escaped. Unlike expanded text, "#" starts
+	// a comment.
+	path = strings.ReplaceAll(path, "$", "$$")
+	path = strings.ReplaceAll(path, "#", `\#`)
+	return escapeMake(path)
+}
+
+// WriteFileIfChanged writes content to the file at path, unless the file already holds
+// content. Leaving the file untouched preserves its modification time, so build tools
+// don't consider anything that depends on it out of date.
+//
+// The file is replaced atomically, and its parent directory is created if necessary.
+func WriteFileIfChanged(path string, content []byte) error {
+	existing, err := os.ReadFile(path)
+	switch {
+	case err == nil && bytes.Equal(existing, content):
+		return nil
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
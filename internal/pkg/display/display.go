@@ -4,19 +4,32 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/iwahbe/helpmakego/internal/pkg/log"
 )
 
-func Relative(ctx context.Context, wd string, paths []string) []string {
+// Relative displays paths relative to wd.
+//
+// Paths inside of any of the keepAbsolute directories are displayed as absolute paths.
+func Relative(ctx context.Context, wd string, paths []string, keepAbsolute ...string) []string {
 	relativePaths := make([]string, len(paths))
 	for i, path := range paths {
-		relativePaths[i] = escapePath(ctx, makeRelative(ctx, wd, path))
+		if slices.ContainsFunc(keepAbsolute, func(dir string) bool { return isWithin(dir, path) }) {
+			relativePaths[i] = filepath.Clean(path)
+			continue
+		}
+		relativePaths[i] = makeRelative(ctx, wd, path)
 	}
 	return relativePaths
 }
 
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func makeRelative(ctx context.Context, wd, path string) string {
 	relPath, err := filepath.Rel(wd, path)
 	if err == nil {
@@ -28,29 +41,72 @@ func makeRelative(ctx context.Context, wd, path string) string {
 	return filepath.Clean(path)
 }
 
-// escapePath tries to make a path printable without error.
-func escapePath(ctx context.Context, path string) string {
-	if !strings.ContainsAny(path, `$"' `) {
-		// No escaping necessary
-		return path
+// Escaping describes how paths are escaped, so the program reading them sees each path as
+// a single word.
+type Escaping string
+
+const (
+	// EscapeMake escapes paths for make, as prerequisites produced by $(shell ...).
+	//
+	// Make has already expanded the output of $(shell ...), so only word separators and
+	// the target separator need escaping: "$" and "#" are read literally.
+	EscapeMake Escaping = "make"
+	// EscapeShell quotes paths for a POSIX shell.
+	EscapeShell Escaping = "shell"
+	// EscapeNone leaves paths as is.
+	EscapeNone Escaping = "none"
+)
+
+// ParseEscaping parses the name of an [Escaping].
+func ParseEscaping(s string) (Escaping, error) {
+	switch e := Escaping(s); e {
+	case EscapeMake, EscapeShell, EscapeNone:
+		return e, nil
+	default:
+		return "", fmt.Errorf(`invalid escaping %q: valid options are "make", "shell" and "none"`, s)
 	}
+}
 
-	// If the string needs to be escaped, but doesn't contain any `'`, then we can
-	// just use those.
-	if !strings.ContainsRune(path, '\'') {
-		return "'" + path + "'"
+// Escape escapes each of paths as described by escaping.
+func Escape(paths []string, escaping Escaping) []string {
+	escape := func(path string) string { return path }
+	switch escaping {
+	case EscapeMake:
+		escape = escapeMake
+	case EscapeShell:
+		escape = escapeShell
 	}
+	escaped := make([]string, len(paths))
+	for i, path := range paths {
+		escaped[i] = escape(path)
+	}
+	return escaped
+}
 
-	// Now we need to escape with just simple ".
-	if !strings.ContainsRune(path, '"') {
-		// If a case is not handled, then we will warn and make a best effort.
-		if strings.ContainsRune(path, '$') {
-			log.Warn(ctx, fmt.Sprintf(`Unable to fully escape path %q: contains a "$"`, path))
+// escapeMake escapes path so make reads it as a single expanded prerequisite.
+func escapeMake(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		switch r {
+		case ' ', '\t', ':':
+			b.WriteRune('\\')
 		}
-		return `"` + path + `"`
+		b.WriteRune(r)
 	}
+	return b.String()
+}
 
-	// We are unable to escape the string, so warn and move on.
-	log.Warn(ctx, fmt.Sprintf(`Unable to escape path %q: contains both "\"" and "'"`, path))
-	return path
+// escapeShell quotes path so a POSIX shell reads it as a single word.
+func escapeShell(path string) string {
+	isSafe := func(r rune) bool {
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' ||
+			strings.ContainsRune("-_./+,@%:=", r)
+	}
+	if path != "" && !strings.ContainsFunc(path, func(r rune) bool { return !isSafe(r) }) {
+		// No escaping necessary
+		return path
+	}
+	// Single quotes preserve everything except a single quote, which we end the
+	// quoted string to escape.
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
 }
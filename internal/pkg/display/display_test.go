@@ -1,28 +1,193 @@
 package display
 
 import (
-	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestEscapePath(t *testing.T) {
+func TestEscape(t *testing.T) {
 	t.Parallel()
 
-	tests := []struct{ input, expected string }{
-		{"file.go", "file.go"},
-		{"a file.go", "'a file.go'"},
-		{`my-"embed".svg`, `'my-"embed".svg'`},
+	tests := []struct {
+		input    string
+		escaping Escaping
+		expected string
+	}{
+		{"file.go", EscapeShell, "file.go"},
+		{"a file.go", EscapeShell, "'a file.go'"},
+		{`my-"embed".svg`, EscapeShell, `'my-"embed".svg'`},
+		{`it's $HOME".go`, EscapeShell, `'it'\''s $HOME".go'`},
+		{"", EscapeShell, "''"},
+		{"file.go", EscapeMake, "file.go"},
+		{"a file.go", EscapeMake, `a\ file.go`},
+		{`$cost#1:"2".go`, EscapeMake, `$cost#1\:"2".go`},
+		{"a file.go", EscapeNone, "a file.go"},
 	}
 
 	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.input, func(t *testing.T) {
+		t.Run(string(tt.escaping)+"/"+tt.input, func(t *testing.T) {
 			t.Parallel()
 
-			actual := escapePath(context.Background(), tt.input)
-			assert.Equal(t, tt.expected, actual)
+			actual := Escape([]string{tt.input}, tt.escaping)
+			assert.Equal(t, []string{tt.expected}, actual)
 		})
 	}
 }
+
+func TestParseEscaping(t *testing.T) {
+	t.Parallel()
+
+	escaping, err := ParseEscaping("shell")
+	require.NoError(t, err)
+	assert.Equal(t, EscapeShell, escaping)
+
+	_, err = ParseEscaping("bash")
+	assert.ErrorContains(t, err, `invalid escaping "bash"`)
+}
+
+func TestMakeDepfile(t *testing.T) {
+	t.Parallel()
+
+	actual := MakeDepfile("bin/my program", []string{"go.mod", "cmd/main.go", "assets/$cost#1:2.txt"})
+	assert.Equal(t, `bin/my\ program: \
+ go.mod \
+ cmd/main.go \
+ assets/$$cost\#1\:2.txt
+
+go.mod:
+
+cmd/main.go:
+
+assets/$$cost\#1\:2.txt:
+`, string(actual))
+}
+
+func TestWriteFileIfChanged(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "deps", "out.d")
+	require.NoError(t, WriteFileIfChanged(path, []byte("a: b\n")))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "a: b\n", string(content))
+
+	// Rewriting the same content leaves the file untouched.
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(path, old, old))
+	require.NoError(t, WriteFileIfChanged(path, []byte("a: b\n")))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, old, info.ModTime())
+
+	require.NoError(t, WriteFileIfChanged(path, []byte("a: c\n")))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "a: c\n", string(content))
+}
+
+func TestNinjaDepfile(t *testing.T) {
+	t.Parallel()
+
+	actual := NinjaDepfile("bin/server", []string{"go.mod", "assets/$cost #1:2.txt"})
+	assert.Equal(t, `bin/server: \
+ go.mod \
+ assets/$$cost\ \#1:2.txt
+`, string(actual))
+}
+
+func TestNinjaBuild(t *testing.T) {
+	t.Parallel()
+
+	actual := string(NinjaRule("go_build", NinjaVar{"command", "go build -o $out $pkg"})) +
+		string(NinjaBuild("bin/my server", "go_build", []string{"go.mod", "a:$b.txt"},
+			NinjaVar{"pkg", NinjaValue("./cmd/$server")}))
+	assert.Equal(t, `rule go_build
+  command = go build -o $out $pkg
+build bin/my$ server: go_build $
+    go.mod $
+    a$:$$b.txt
+  pkg = ./cmd/$$server
+`, actual)
+}
+
+func TestMakeRule(t *testing.T) {
+	t.Parallel()
+
+	actual := MakeRule("bin/server", []string{"go.mod", "main.go"}, []string{"go build -o $@ ./cmd/server"})
+	assert.Equal(t, "bin/server: \\\n go.mod \\\n main.go\n\tgo build -o $@ ./cmd/server\n", string(actual))
+
+	actual = MakeRule("bin/a$b", nil, []string{"go build -o $@ " + MakeValue("'./cmd/a$b'")})
+	assert.Equal(t, "bin/a$$b:\n\tgo build -o $@ './cmd/a$$b'\n", string(actual))
+}
+
+func testPackageGraph() PackageGraph {
+	return PackageGraph{
+		Roots: []string{"example.com/app"},
+		Nodes: []PackageNode{
+			{ImportPath: "example.com/app", Module: "example.com/app", ModuleRoot: "app", Via: "root", Files: 2},
+			{ImportPath: "example.com/app/internal/web", Module: "example.com/app", ModuleRoot: "app", Via: "module", Files: 3},
+			{ImportPath: "example.com/lib", Module: "example.com/lib", ModuleRoot: "lib", Via: "replace", Files: 1},
+			{ImportPath: "example.com/lib/sub", Module: "example.com/lib", ModuleRoot: "lib", Via: "module", Files: 1},
+		},
+		Edges: []PackageImport{
+			{From: "example.com/app", To: "example.com/app/internal/web"},
+			{From: "example.com/app", To: "example.com/lib/sub", Test: true},
+			{From: "example.com/app/internal/web", To: "example.com/lib"},
+			{From: "example.com/lib", To: "example.com/lib/sub"},
+		},
+	}
+}
+
+func TestPackageGraphCollapseModules(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, PackageGraph{
+		Roots: []string{"example.com/app"},
+		Nodes: []PackageNode{
+			{ImportPath: "example.com/app", Module: "example.com/app", ModuleRoot: "app", Via: "root", Files: 5},
+			{ImportPath: "example.com/lib", Module: "example.com/lib", ModuleRoot: "lib", Via: "replace", Files: 2},
+		},
+		Edges: []PackageImport{
+			{From: "example.com/app", To: "example.com/lib"},
+		},
+	}, testPackageGraph().CollapseModules())
+}
+
+func TestPackageGraphDot(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `digraph packages {
+	node [shape=box];
+	"example.com/app" [label="example.com/app\nmodule: app\n2 files", style=bold];
+	"example.com/app/internal/web" [label="example.com/app/internal/web\nmodule: app\n3 files"];
+	"example.com/lib" [label="example.com/lib\nmodule: lib\nvia replace\n1 file"];
+	"example.com/lib/sub" [label="example.com/lib/sub\nmodule: lib\n1 file"];
+	"example.com/app" -> "example.com/app/internal/web";
+	"example.com/app" -> "example.com/lib/sub" [style=dashed];
+	"example.com/app/internal/web" -> "example.com/lib";
+	"example.com/lib" -> "example.com/lib/sub";
+}
+`, string(testPackageGraph().Dot()))
+}
+
+func TestPackageGraphMermaid(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `flowchart LR
+	n0["example.com/app<br/>module: app<br/>2 files"]
+	n1["example.com/app/internal/web<br/>module: app<br/>3 files"]
+	n2["example.com/lib<br/>module: lib<br/>via replace<br/>1 file"]
+	n3["example.com/lib/sub<br/>module: lib<br/>1 file"]
+	n0 --> n1
+	n0 -.-> n3
+	n1 --> n2
+	n2 --> n3
+	classDef root font-weight:bold,stroke-width:3px
+	class n0 root
+`, string(testPackageGraph().Mermaid()))
+}
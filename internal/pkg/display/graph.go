@@ -0,0 +1,198 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PackageGraph is a package import graph, prepared for display.
+type PackageGraph struct {
+	// Roots holds the import paths of the root packages.
+	Roots []string        `json:"roots"`
+	Nodes []PackageNode   `json:"nodes"`
+	Edges []PackageImport `json:"edges"`
+}
+
+// PackageNode is a package in a [PackageGraph].
+type PackageNode struct {
+	ImportPath string `json:"importPath"`
+	// Module is the path of the module that provides the package, if known.
+	Module string `json:"module,omitempty"`
+	// ModuleRoot is the directory of the module that provides the package, if known.
+	ModuleRoot string `json:"moduleRoot,omitempty"`
+	// Via describes how the package was resolved, such as "replace" or "workspace".
+	Via string `json:"via"`
+	// Files is the number of files the package depends on.
+	Files int `json:"files"`
+}
+
+// PackageImport is an edge in a [PackageGraph].
+type PackageImport struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Test reports if the import is only made by tests.
+	Test bool `json:"test,omitempty"`
+}
+
+// CollapseModules returns g with each module collapsed into a single node.
+//
+// Packages without a known module are left as is. The edges between modules are the
+// union of the edges between their packages.
+func (g PackageGraph) CollapseModules() PackageGraph {
+	group := func(n PackageNode) string {
+		if n.Module == "" {
+			return n.ImportPath
+		}
+		return n.Module
+	}
+
+	groups := map[string]string{} // import path -> group
+	collapsed := PackageGraph{Nodes: []PackageNode{}, Edges: []PackageImport{}}
+	nodes := map[string]int{} // group -> index into collapsed.Nodes
+	for _, n := range g.Nodes {
+		id := group(n)
+		groups[n.ImportPath] = id
+		i, ok := nodes[id]
+		if !ok {
+			nodes[id] = len(collapsed.Nodes)
+			collapsed.Nodes = append(collapsed.Nodes, PackageNode{
+				ImportPath: id,
+				Module:     n.Module,
+				ModuleRoot: n.ModuleRoot,
+				Via:        n.Via,
+				Files:      n.Files,
+			})
+			continue
+		}
+		collapsed.Nodes[i].Files += n.Files
+		if viaRank(n.Via) > viaRank(collapsed.Nodes[i].Via) {
+			collapsed.Nodes[i].Via = n.Via
+		}
+	}
+
+	for _, root := range g.Roots {
+		collapsed.Roots = append(collapsed.Roots, groups[root])
+	}
+	slices.Sort(collapsed.Roots)
+	collapsed.Roots = slices.Compact(collapsed.Roots)
+
+	edges := map[[2]string]int{} // (from, to) -> index into collapsed.Edges
+	for _, e := range g.Edges {
+		from, to := groups[e.From], groups[e.To]
+		if from == to {
+			continue
+		}
+		i, ok := edges[[2]string{from, to}]
+		if !ok {
+			edges[[2]string{from, to}] = len(collapsed.Edges)
+			collapsed.Edges = append(collapsed.Edges, PackageImport{From: from, To: to, Test: e.Test})
+			continue
+		}
+		collapsed.Edges[i].Test = collapsed.Edges[i].Test && e.Test
+	}
+	return collapsed
+}
+
+// viaRank orders resolutions, so a collapsed module shows the most notable resolution
+// of its packages.
+func viaRank(via string) int {
+	switch via {
+	case "root":
+		return 2
+	case "module", "":
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Dot renders g in the Graphviz DOT language.
+//
+// Root packages are bold, and imports only made by tests are dashed.
+func (g PackageGraph) Dot() []byte {
+	var b bytes.Buffer
+	b.WriteString("digraph packages {\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "\t%s [label=%s", dotQuote(n.ImportPath), dotQuote(strings.Join(nodeLabel(n), "\n")))
+		if slices.Contains(g.Roots, n.ImportPath) {
+			b.WriteString(", style=bold")
+		}
+		b.WriteString("];\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s", dotQuote(e.From), dotQuote(e.To))
+		if e.Test {
+			b.WriteString(" [style=dashed]")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// Mermaid renders g as a Mermaid flowchart.
+//
+// Root packages are bold, and imports only made by tests are dotted.
+func (g PackageGraph) Mermaid() []byte {
+	ids := make(map[string]string, len(g.Nodes))
+	var b bytes.Buffer
+	b.WriteString("flowchart LR\n")
+	for i, n := range g.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.ImportPath] = id
+		lines := nodeLabel(n)
+		for i, line := range lines {
+			lines[i] = strings.ReplaceAll(line, `"`, "#quot;")
+		}
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", id, strings.Join(lines, "<br/>"))
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Test {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "\t%s %s %s\n", ids[e.From], arrow, ids[e.To])
+	}
+	if len(g.Roots) > 0 {
+		b.WriteString("\tclassDef root font-weight:bold,stroke-width:3px\n")
+		for _, root := range g.Roots {
+			fmt.Fprintf(&b, "\tclass %s root\n", ids[root])
+		}
+	}
+	return b.Bytes()
+}
+
+// nodeLabel returns the lines that describe n.
+func nodeLabel(n PackageNode) []string {
+	lines := []string{n.ImportPath}
+	if n.ModuleRoot != "" {
+		lines = append(lines, "module: "+n.ModuleRoot)
+	}
+	switch n.Via {
+	case "replace":
+		lines = append(lines, "via replace")
+	case "workspace":
+		lines = append(lines, "via go.work")
+	case "vendor":
+		lines = append(lines, "vendored")
+	case "external":
+		lines = append(lines, "module cache")
+	}
+	if n.Files == 1 {
+		lines = append(lines, "1 file")
+	} else {
+		lines = append(lines, fmt.Sprintf("%d files", n.Files))
+	}
+	return lines
+}
+
+// dotQuote quotes s as a DOT string, where "\n" is a line break.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
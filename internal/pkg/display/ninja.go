@@ -0,0 +1,100 @@
+package display
+
+import (
+	"bytes"
+	"strings"
+)
+
+// NinjaDepfile renders a depfile that ninja reads with `deps = gcc`: target depends on each
+// of prerequisites.
+//
+// Unlike [MakeDepfile], no rules are written for prerequisites: ninja doesn't need them to
+// handle deleted files.
+func NinjaDepfile(target string, prerequisites []string) []byte {
+	var b bytes.Buffer
+	b.WriteString(escapeNinjaDep(target))
+	b.WriteString(":")
+	for _, p := range prerequisites {
+		b.WriteString(" \\\n ")
+		b.WriteString(escapeNinjaDep(p))
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// escapeNinjaDep escapes path for ninja's depfile parser.
+//
+// Ninja's parser only splits targets on a colon followed by whitespace, so colons are not
+// escaped.
+func escapeNinjaDep(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		switch r {
+		case ' ', '\t', '#':
+			b.WriteRune('\\')
+		case '$':
+			b.WriteRune('$')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// NinjaVar is a variable binding in a ninja file.
+//
+// Value is written as is, so it can reference other variables. Use [NinjaValue] to bind a
+// literal value.
+type NinjaVar struct{ Name, Value string }
+
+// NinjaValue escapes s so ninja reads it literally as the value of a variable.
+func NinjaValue(s string) string { return strings.ReplaceAll(s, "$", "$$") }
+
+// NinjaRule renders a ninja rule named name, with each of vars bound in order.
+func NinjaRule(name string, vars ...NinjaVar) []byte {
+	var b bytes.Buffer
+	b.WriteString("rule ")
+	b.WriteString(name)
+	b.WriteString("\n")
+	writeNinjaVars(&b, vars)
+	return b.Bytes()
+}
+
+// NinjaBuild renders a ninja build edge that builds output from inputs with rule. Each
+// of vars is bound for the edge, in order.
+func NinjaBuild(output, rule string, inputs []string, vars ...NinjaVar) []byte {
+	var b bytes.Buffer
+	b.WriteString("build ")
+	b.WriteString(escapeNinjaPath(output))
+	b.WriteString(": ")
+	b.WriteString(rule)
+	for _, input := range inputs {
+		b.WriteString(" $\n    ")
+		b.WriteString(escapeNinjaPath(input))
+	}
+	b.WriteString("\n")
+	writeNinjaVars(&b, vars)
+	return b.Bytes()
+}
+
+func writeNinjaVars(b *bytes.Buffer, vars []NinjaVar) {
+	for _, v := range vars {
+		b.WriteString("  ")
+		b.WriteString(v.Name)
+		b.WriteString(" = ")
+		b.WriteString(v.Value)
+		b.WriteString("\n")
+	}
+}
+
+// escapeNinjaPath escapes path so ninja reads it as a single path in a build statement.
+func escapeNinjaPath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		switch r {
+		case '$', ' ', ':':
+			b.WriteRune('$')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
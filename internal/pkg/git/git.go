@@ -0,0 +1,106 @@
+// Package git finds changed files with the local git command.
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+)
+
+// ChangedFiles returns the absolute paths of the files that changed in the repository
+// enclosing dir since it diverged from rev, sorted.
+//
+// Changes are measured from the merge base of rev and HEAD to the working tree, so they
+// include committed, staged, unstaged and untracked changes. Both the old and the new path
+// of a renamed file are reported, and deleted files are reported even though they no
+// longer exist.
+//
+// Paths are reported below dir as given, even when the repository is reached through a
+// symlink, so they match paths found from dir.
+//
+// ChangedFiles only reads the local repository: rev must already be known locally, such
+// as a remote tracking branch like origin/main.
+func ChangedFiles(ctx context.Context, dir, rev string) ([]string, error) {
+	top, err := Toplevel(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := run(ctx, top, "merge-base", rev, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	base = strings.TrimSpace(base)
+	log.Debug(ctx, "Found merge base", log.Attr("rev", rev), log.Attr("base", base))
+
+	// --no-renames reports a rename as the deletion of the old path and the addition of
+	// the new path.
+	diff, err := run(ctx, top, "diff", "--name-only", "-z", "--no-renames", "--no-relative", base, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := run(ctx, top, "ls-files", "--others", "--exclude-standard", "--full-name", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, out := range []string{diff, untracked} {
+		for _, file := range strings.Split(out, "\x00") {
+			if file == "" {
+				continue
+			}
+			files = append(files, filepath.Join(top, filepath.FromSlash(file)))
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// Toplevel returns the absolute path of the root of the repository enclosing dir, which
+// git prints paths relative to (such as with `git diff --name-only`).
+//
+// Like [ChangedFiles], the root is reported above dir as given, even when the repository
+// is reached through a symlink.
+func Toplevel(ctx context.Context, dir string) (string, error) {
+	out, err := run(ctx, dir, "rev-parse", "--show-toplevel", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	top, prefix, _ := strings.Cut(strings.TrimSuffix(out, "\n"), "\n")
+	// git reports the toplevel with symlinks resolved, so it is found from dir instead,
+	// by removing the path of dir within the repository (its prefix).
+	if abs, err := filepath.Abs(dir); err == nil {
+		dirTop := abs
+		for range strings.Count(prefix, "/") {
+			dirTop = filepath.Dir(dirTop)
+		}
+		if filepath.Join(dirTop, filepath.FromSlash(prefix)) == abs {
+			top = dirTop
+		}
+	}
+	return top, nil
+}
+
+// run runs git with args in dir, returning its stdout.
+func run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s failed: %w", args[0], err)
+		}
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, msg)
+	}
+	return stdout.String(), nil
+}
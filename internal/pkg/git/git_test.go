@@ -0,0 +1,106 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedFiles(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// git reports the resolved path of the repository.
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = tmpDir
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "git %v: %s", args, out)
+	}
+	write := func(path, content string) {
+		t.Helper()
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	git("init", "--quiet", "--initial-branch=main")
+	for _, path := range []string{
+		"committed.go", "staged.go", "unstaged.go", "deleted.go", "old/renamed.go",
+		"unchanged.go", "main.go",
+	} {
+		write(path, path)
+	}
+	write(".gitignore", "ignored.go\n")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "base")
+	// Pretend main was fetched from a remote, without one.
+	git("update-ref", "refs/remotes/origin/main", "HEAD")
+
+	git("checkout", "--quiet", "-b", "feature")
+	write("committed.go", "changed")
+	git("rm", "--quiet", "deleted.go")
+	require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "new"), 0755))
+	git("mv", "old/renamed.go", "new/renamed.go")
+	git("commit", "--quiet", "-am", "feature")
+
+	// Changes to origin/main after the feature branched off are not changes of the branch.
+	git("checkout", "--quiet", "main")
+	write("main.go", "changed")
+	git("commit", "--quiet", "-am", "main")
+	git("update-ref", "refs/remotes/origin/main", "HEAD")
+	git("checkout", "--quiet", "feature")
+
+	write("staged.go", "changed")
+	git("add", "staged.go")
+	write("unstaged.go", "changed")
+	write("sub/untracked.go", "new")
+	write("ignored.go", "ignored")
+
+	files, err := ChangedFiles(t.Context(), filepath.Join(tmpDir, "sub"), "origin/main")
+	require.NoError(t, err)
+	var expected []string
+	for _, path := range []string{
+		"committed.go", "deleted.go", "new/renamed.go", "old/renamed.go",
+		"staged.go", "sub/untracked.go", "unstaged.go",
+	} {
+		expected = append(expected, filepath.Join(tmpDir, path))
+	}
+	assert.Equal(t, expected, files)
+
+	top, err := Toplevel(t.Context(), filepath.Join(tmpDir, "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir, top)
+
+	// Paths are reported below a symlink to the repository, as the graph finds them.
+	link := filepath.Join(t.TempDir(), "link")
+	require.NoError(t, os.Symlink(tmpDir, link))
+	top, err = Toplevel(t.Context(), filepath.Join(link, "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, link, top)
+	files, err = ChangedFiles(t.Context(), filepath.Join(link, "sub"), "origin/main")
+	require.NoError(t, err)
+	for i, path := range expected {
+		rel, err := filepath.Rel(tmpDir, path)
+		require.NoError(t, err)
+		expected[i] = filepath.Join(link, rel)
+	}
+	assert.Equal(t, expected, files)
+
+	_, err = ChangedFiles(t.Context(), tmpDir, "origin/missing")
+	assert.Error(t, err)
+}
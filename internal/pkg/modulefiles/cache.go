@@ -2,48 +2,75 @@ package modulefiles
 
 import (
 	"context"
+	"errors"
 	"go/build"
+	"path/filepath"
 	"sync"
 )
 
 type Cache struct {
-	modules  *sync.Map // map[lookupKey]*modules
-	packages cachedImporter
-	modRoot  string
+	modules   *sync.Map // map[lookupKey]*modules
+	importers *sync.Map // map[string]cachedImporter, keyed by Config.key()
+	modRoot   string
+	watch     func(files, dirs []string)
 }
 
 func NewCache(ctx context.Context, pkgRoot string) (Cache, error) {
+	return NewWatchedCache(ctx, pkgRoot, nil)
+}
+
+// NewWatchedCache returns a cache that calls watch with the paths its results depend on,
+// before they are read: the go.mod files and the package directories. The Go files read
+// from a directory are passed to watch once they are known, after the directory.
+//
+// When any of them changes, call [Cache.Invalidate] with the path that changed.
+func NewWatchedCache(ctx context.Context, pkgRoot string, watch func(files, dirs []string)) (Cache, error) {
 	c := Cache{
-		modules:  new(sync.Map),
-		packages: cachedImporter{packages: new(sync.Map)},
+		modules:   new(sync.Map),
+		importers: new(sync.Map),
+		watch:     watch,
 	}
 	modRoot, err := c.getModules(lookupKey{}).findGoMod(ctx, pkgRoot)
 	c.modRoot = modRoot.rootDir
 	return c, err
 }
 
-type cachedImporter struct{ packages *sync.Map }
+type cachedImporter struct {
+	ctxt     *build.Context
+	packages *sync.Map // map[importKey]importResult
+	watch    func(files, dirs []string)
+}
 
-func (c cachedImporter) ImportDir(dir string, mode build.ImportMode) (*build.Package, error) {
-	type (
-		key struct {
-			dir  string
-			mode build.ImportMode
-		}
-		value struct {
-			pkg *build.Package
-			err error
-		}
-	)
+type (
+	importKey struct {
+		dir  string
+		mode build.ImportMode
+	}
+	importResult struct {
+		pkg *build.Package
+		err error
+	}
+)
 
-	k := key{dir, mode}
+func (c cachedImporter) ImportDir(dir string, mode build.ImportMode) (*build.Package, error) {
+	k := importKey{dir, mode}
 	v, ok := c.packages.Load(k)
 	if !ok {
-		pkg, err := build.Default.ImportDir(dir, mode)
-		v, _ = c.packages.LoadOrStore(k, value{pkg, err})
+		if c.watch != nil {
+			c.watch(nil, []string{dir})
+		}
+		pkg, err := c.ctxt.ImportDir(dir, mode)
+		if c.watch != nil && pkg != nil {
+			var files []string
+			applyNested(func(name string) { files = append(files, filepath.Join(dir, name)) },
+				pkg.GoFiles, pkg.CgoFiles, pkg.IgnoredGoFiles, pkg.InvalidGoFiles,
+				pkg.TestGoFiles, pkg.XTestGoFiles)
+			c.watch(files, nil)
+		}
+		v, _ = c.packages.LoadOrStore(k, importResult{pkg, err})
 	}
 
-	val := v.(value)
+	val := v.(importResult)
 	return val.pkg, val.err
 
 }
@@ -53,20 +80,79 @@ func (c Cache) getModules(key lookupKey) *modules {
 	if ok {
 		return k.(*modules)
 	}
-	k, _ = c.modules.LoadOrStore(key, new(modules))
+	k, _ = c.modules.LoadOrStore(key, &modules{watch: c.watch})
 	return k.(*modules)
 }
 
-func (c Cache) Find(ctx context.Context, pkg string, testPaths, modFiles, goWork bool) ([]string, error) {
-	return findWithModules(ctx, pkg, testPaths, modFiles, goWork, c.getModules(lookupKey{
-		test: testPaths,
-		mod:  modFiles,
-		work: goWork,
-	}), c.packages)
+// getImporter returns the importer shared by all lookups under config.
+func (c Cache) getImporter(config Config) importer {
+	key := config.key()
+	i, ok := c.importers.Load(key)
+	if ok {
+		return i.(cachedImporter)
+	}
+	i, _ = c.importers.LoadOrStore(key, cachedImporter{
+		ctxt:     config.buildContext(),
+		packages: new(sync.Map),
+		watch:    c.watch,
+	})
+	return i.(cachedImporter)
+}
+
+func (c Cache) Find(ctx context.Context, roots []string, testPaths, modFiles, goWork bool, config Config) ([]string, error) {
+	graph, err := c.FindGraph(ctx, roots, testPaths, modFiles, goWork, config)
+	if graph == nil {
+		return nil, err
+	}
+	return graph.findResult(config), err
+}
+
+func (c Cache) FindGraph(ctx context.Context, roots []string, testPaths, modFiles, goWork bool, config Config) (*Graph, error) {
+	return findGraph(ctx, roots, testPaths, modFiles, goWork, config, c.getModules(lookupKey{
+		test:   testPaths,
+		mod:    modFiles,
+		work:   goWork,
+		config: config.key(),
+	}), c.getImporter)
 }
 
 func (c Cache) ModuleRoot() string { return c.modRoot }
 
+// Invalidate evicts the results cached by c that depend on path, a file or directory that
+// was changed, added or removed. An empty path evicts every result.
+//
+// go.work files are read again for every lookup, so they never need to be invalidated.
+func (c Cache) Invalidate(path string) {
+	// A change to a directory's entries (or to one of its Go files) changes the
+	// package in the directory. A removed directory takes its subdirectories with it.
+	dir := filepath.Dir(path)
+	c.importers.Range(func(_, i any) bool {
+		i.(cachedImporter).packages.Range(func(k, _ any) bool {
+			if d := k.(importKey).dir; path == "" || d == dir || isWithin(path, d) {
+				i.(cachedImporter).packages.Delete(k)
+			}
+			return true
+		})
+		return true
+	})
+
+	// Directories are cached to the module that encloses them, which a go.mod added,
+	// changed or removed below them can change.
+	within := path
+	if filepath.Base(path) == "go.mod" {
+		within = dir
+	}
+	c.modules.Range(func(_, m any) bool {
+		m.(*modules).dirs.Range(func(k, _ any) bool {
+			if path == "" || isWithin(within, k.(string)) {
+				m.(*modules).dirs.Delete(k)
+			}
+			return true
+		})
+		return true
+	})
+}
+
 // Find the module root of a given package directory.
 //
 // FindModuleRoot does not share a cache, and should only be used to support connecting
@@ -77,4 +163,37 @@ func FindModuleRoot(ctx context.Context, pkgRoot string) (string, error) {
 	return goMod.rootDir, err
 }
 
-type lookupKey struct{ test, mod, work bool }
+// MainModules returns the root directories of the main modules that dir is built in: the
+// modules used by the enclosing go.work (if goWork), or else the module enclosing dir.
+func MainModules(ctx context.Context, dir string, goWork bool) ([]string, error) {
+	// The search for go.work and go.mod files walks up from dir, so it needs an
+	// absolute path.
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var modules modules
+	if goWork {
+		work, err := modules.findGoWork(ctx, dir)
+		switch {
+		case err == nil:
+			dirs := make([]string, len(work.file.Use))
+			for i, u := range work.file.Use {
+				dirs[i] = filepath.Join(work.rootDir, filepath.FromSlash(u.Path))
+			}
+			return dirs, nil
+		case !errors.Is(err, errNoGoWorkFound):
+			return nil, err
+		}
+	}
+	goMod, err := modules.findGoMod(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return []string{goMod.rootDir}, nil
+}
+
+type lookupKey struct {
+	test, mod, work bool
+	config          string // The result of Config.key()
+}
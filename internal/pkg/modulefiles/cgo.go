@@ -0,0 +1,208 @@
+package modulefiles
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+)
+
+// includeRegexp matches a quoted #include directive, capturing the included path.
+//
+// System includes (#include <...>) are never local, so they are not matched.
+var includeRegexp = regexp.MustCompile(`^\s*#\s*include\s*"([^"]+)"`)
+
+// addIncludes adds the local headers included by pkg's C preprocessed sources (and cgo
+// preambles), transitively.
+//
+// Quoted includes are resolved like a C compiler would: first against the directory of
+// the including file, then against each -iquote and -I directory in the cgo flags. Only
+// headers within pkg's module are considered local.
+func addIncludes(ctx context.Context, pkg *build.Package, modules *modules, cgoEnabled bool, addFile addFile) error {
+	sources := slices.Clone(pkg.SFiles) // The Go assembler runs the C preprocessor too.
+	if cgoEnabled {
+		sources = slices.Concat(sources, pkg.CFiles, pkg.CXXFiles, pkg.MFiles, pkg.HFiles)
+	}
+	if len(sources) == 0 && (!cgoEnabled || len(pkg.CgoFiles) == 0) {
+		return nil
+	}
+
+	mod, err := modules.findGoMod(ctx, pkg.Dir)
+	if err != nil {
+		log.Debug(ctx, "Skipping includes: unable to find module", log.Attr("package", pkg.Dir))
+		return nil
+	}
+
+	r := includeResolver{
+		moduleRoot: mod.rootDir,
+		seen:       map[string]struct{}{},
+		add: func(path string) {
+			rel, err := filepath.Rel(pkg.Dir, path)
+			if err != nil {
+				rel = path
+			}
+			addFile(rel)
+		},
+	}
+
+	var errs []error
+	if cgoEnabled {
+		r.includeDirs = cgoIncludeDirs(pkg)
+		for _, file := range pkg.CgoFiles {
+			preamble, err := cgoPreamble(filepath.Join(pkg.Dir, file))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			errs = append(errs, r.scan(ctx, pkg.Dir, strings.NewReader(preamble)))
+		}
+	}
+
+	for _, file := range sources {
+		errs = append(errs, r.scanFile(ctx, filepath.Join(pkg.Dir, file)))
+	}
+	return errors.Join(errs...)
+}
+
+type includeResolver struct {
+	moduleRoot  string
+	includeDirs []string
+	// seen holds each file that has already been scanned.
+	seen map[string]struct{}
+	add  func(path string)
+}
+
+func (r *includeResolver) scanFile(ctx context.Context, path string) error {
+	if _, ok := r.seen[path]; ok {
+		return nil
+	}
+	r.seen[path] = struct{}{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not scan includes: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return r.scan(ctx, filepath.Dir(path), f)
+}
+
+func (r *includeResolver) scan(ctx context.Context, dir string, f io.Reader) error {
+	var errs []error
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := includeRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		header, ok := r.resolve(dir, m[1])
+		if !ok {
+			log.Debug(ctx, "Skipping non-local include", log.Attr("include", m[1]), log.Attr("dir", dir))
+			continue
+		}
+		r.add(header)
+		errs = append(errs, r.scanFile(ctx, header))
+	}
+	return errors.Join(append(errs, scanner.Err())...)
+}
+
+func (r *includeResolver) resolve(dir, include string) (string, bool) {
+	if filepath.IsAbs(include) {
+		return include, r.isLocal(include)
+	}
+	for _, d := range slices.Concat([]string{dir}, r.includeDirs) {
+		path := filepath.Join(d, filepath.FromSlash(include))
+		if r.isLocal(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// isLocal checks if path is an existing file within the module.
+func (r *includeResolver) isLocal(path string) bool {
+	if !isWithin(r.moduleRoot, path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// cgoIncludeDirs returns the directories that quoted includes are searched in, as
+// specified by the -iquote and -I flags of pkg's #cgo directives.
+//
+// go/build has already expanded ${SRCDIR}.
+func cgoIncludeDirs(pkg *build.Package) []string {
+	var dirs []string
+	for _, flags := range [][]string{pkg.CgoCPPFLAGS, pkg.CgoCFLAGS, pkg.CgoCXXFLAGS} {
+		for i := 0; i < len(flags); i++ {
+			var dir string
+			switch flag := flags[i]; {
+			case flag == "-I" || flag == "-iquote":
+				if i+1 < len(flags) {
+					i++
+					dir = flags[i]
+				}
+			case strings.HasPrefix(flag, "-I"):
+				dir = strings.TrimPrefix(flag, "-I")
+			case strings.HasPrefix(flag, "-iquote"):
+				dir = strings.TrimPrefix(flag, "-iquote")
+			}
+			if dir == "" {
+				continue
+			}
+			if !filepath.IsAbs(dir) {
+				// Relative paths are relative to the package directory, where the
+				// compiler is invoked.
+				dir = filepath.Join(pkg.Dir, dir)
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// cgoPreamble returns the cgo preamble (the doc comment on `import "C"`) in the Go file at
+// path.
+func cgoPreamble(path string) (string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("could not parse cgo preamble: %w", err)
+	}
+
+	var preamble strings.Builder
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != "C" {
+				continue
+			}
+			// Like go/build, the doc comment is on the spec in a grouped
+			// import and on the declaration otherwise.
+			doc := spec.Doc
+			if doc == nil && len(d.Specs) == 1 {
+				doc = d.Doc
+			}
+			if doc != nil {
+				preamble.WriteString(doc.Text())
+			}
+		}
+	}
+	return preamble.String(), nil
+}
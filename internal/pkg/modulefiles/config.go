@@ -0,0 +1,181 @@
+package modulefiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Config describes the build configuration that packages are resolved against.
+//
+// The zero value resolves packages exactly as [build.Default] would.
+type Config struct {
+	// Tags lists additional build tags to consider satisfied, as with `go build -tags`.
+	Tags []string `json:"tags,omitempty"`
+
+	// GOOS and GOARCH describe the target platform. Empty values default to the
+	// platform of [build.Default].
+	GOOS   string `json:"goos,omitempty"`
+	GOARCH string `json:"goarch,omitempty"`
+	// GOARM and GOAMD64 describe the architecture features of the target, in the
+	// format of the environmental variables of the same name.
+	GOARM   string `json:"goarm,omitempty"`
+	GOAMD64 string `json:"goamd64,omitempty"`
+
+	// CgoEnabled controls whether cgo is enabled, as with CGO_ENABLED. When nil, cgo is
+	// enabled as it is for [build.Default], except when cross compiling.
+	CgoEnabled *bool `json:"cgoEnabled,omitempty"`
+
+	// GoVersion is the version of the go toolchain that builds packages, such as
+	// "go1.23.4" or "1.23". It determines which "go1.N" release tags are satisfied.
+	//
+	// When empty, the toolchain is selected as the go command would: from GOTOOLCHAIN
+	// and the go and toolchain lines of go.work or go.mod.
+	GoVersion string `json:"goVersion,omitempty"`
+	// GOTOOLCHAIN holds the value of the environmental variable of the same name.
+	GOTOOLCHAIN string `json:"gotoolchain,omitempty"`
+
+	// Vendor controls whether packages outside of the main modules are resolved from
+	// the vendor directory, as with -mod=vendor. When nil, the vendor directory is used
+	// if the go command would use it by default.
+	Vendor *bool `json:"vendor,omitempty"`
+
+	// External resolves imports of modules outside of the main modules (and their local
+	// replaces) from the module cache, instead of skipping them. The module cache is never
+	// populated: modules that are not already downloaded are reported as errors.
+	External bool `json:"external,omitempty"`
+	// GOMODCACHE holds the value of the environmental variable of the same name.
+	GOMODCACHE string `json:"gomodcache,omitempty"`
+
+	// Platforms, when non-empty, resolves packages for each platform listed and takes
+	// the union of the results. GOOS and GOARCH are ignored when Platforms is set.
+	Platforms []Platform `json:"platforms,omitempty"`
+
+	// EmbedWarnings downgrades go:embed patterns that the go command would reject (see
+	// [EmbedError]) from errors to logged warnings.
+	EmbedWarnings bool `json:"embedWarnings,omitempty"`
+
+	// Dirs reports the directories whose entries decide the files that packages depend
+	// on (see [Graph.Dirs]) alongside the files themselves.
+	Dirs bool `json:"dirs,omitempty"`
+}
+
+// platforms returns a Config for each platform that c resolves packages for.
+func (c Config) platforms() []Config {
+	if len(c.Platforms) == 0 {
+		return []Config{c}
+	}
+	configs := make([]Config, len(c.Platforms))
+	for i, p := range c.Platforms {
+		configs[i] = c
+		configs[i].Platforms = nil
+		configs[i].GOOS, configs[i].GOARCH = p.GOOS, p.GOARCH
+	}
+	return configs
+}
+
+// buildContext returns the [build.Context] that c describes.
+func (c Config) buildContext() *build.Context {
+	ctxt := build.Default
+	ctxt.BuildTags = slices.Concat(build.Default.BuildTags, c.Tags)
+
+	if c.GOOS != "" {
+		ctxt.GOOS = c.GOOS
+	}
+	if c.GOARCH != "" {
+		ctxt.GOARCH = c.GOARCH
+	}
+	if c.GOARCH != "" || c.GOARM != "" || c.GOAMD64 != "" {
+		// The architecture feature tags are derived from the target, so we
+		// need to recompute them. GOEXPERIMENT tags are independent of the
+		// target, so we keep them.
+		ctxt.ToolTags = slices.DeleteFunc(slices.Clone(build.Default.ToolTags), func(tag string) bool {
+			return !strings.HasPrefix(tag, "goexperiment.")
+		})
+		ctxt.ToolTags = append(ctxt.ToolTags, archTags(ctxt.GOARCH, c.GOARM, c.GOAMD64)...)
+	}
+
+	if c.GoVersion != "" {
+		ctxt.ReleaseTags = releaseTags(c.GoVersion)
+	}
+
+	switch {
+	case c.CgoEnabled != nil:
+		ctxt.CgoEnabled = *c.CgoEnabled
+	// Like the go command, cgo must be explicitly enabled for cross compilation.
+	case (ctxt.GOOS != runtime.GOOS || ctxt.GOARCH != runtime.GOARCH) && os.Getenv("CGO_ENABLED") == "":
+		ctxt.CgoEnabled = false
+	}
+	return &ctxt
+}
+
+// resolved returns c with the defaults it leaves to the environment filled in, where
+// vendored reports whether packages are resolved from the vendor directory.
+//
+// GoVersion must already be resolved.
+func (c Config) resolved(vendored bool) Config {
+	if len(c.Platforms) == 0 {
+		ctxt := c.buildContext()
+		c.GOOS, c.GOARCH = ctxt.GOOS, ctxt.GOARCH
+		c.CgoEnabled = &ctxt.CgoEnabled
+	}
+	c.Vendor = &vendored
+	return c
+}
+
+// archTags returns the architecture feature build tags (such as "amd64.v2") that the go
+// tool sets for goarch.
+//
+// goarm and goamd64 are the values of GOARM and GOAMD64 respectively. When empty, the
+// go tool's defaults are used.
+func archTags(goarch, goarm, goamd64 string) []string {
+	var tags []string
+	levels := func(format string, from, to int) {
+		for i := from; i <= to; i++ {
+			tags = append(tags, fmt.Sprintf(format, goarch, i))
+		}
+	}
+	switch goarch {
+	case "386":
+		tags = append(tags, goarch+".sse2")
+	case "amd64":
+		level := 1
+		if v, err := strconv.Atoi(strings.TrimPrefix(goamd64, "v")); err == nil {
+			level = v
+		}
+		levels("%s.v%d", 1, level)
+	case "arm":
+		level := 7
+		// GOARM may carry a floating point suffix, such as "7,softfloat".
+		version, _, _ := strings.Cut(goarm, ",")
+		if v, err := strconv.Atoi(version); err == nil {
+			level = v
+		}
+		levels("%s.%d", 5, level)
+	case "arm64":
+		tags = append(tags, goarch+".v8.0")
+	case "mips", "mipsle", "mips64", "mips64le":
+		tags = append(tags, goarch+".hardfloat")
+	case "ppc64", "ppc64le":
+		tags = append(tags, goarch+".power8")
+	case "riscv64":
+		tags = append(tags, goarch+".rva20u64")
+	case "wasm":
+		tags = append(tags, goarch+".satconv", goarch+".signext")
+	}
+	return tags
+}
+
+// key returns a comparable value that uniquely identifies c.
+func (c Config) key() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		panic(err) // Config is always serializable
+	}
+	return string(b)
+}
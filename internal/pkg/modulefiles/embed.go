@@ -8,16 +8,62 @@ import (
 	"path"
 	"strconv"
 	"strings"
+
+	gomodule "golang.org/x/mod/module"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
 )
 
-func expandEmbeds(ctx context.Context, root fs.FS, embeds []string, addFile addFile) error {
+// expandEmbeds adds the files matched by each of the go:embed patterns in embeds, noting
+// the pattern that matched each file.
+func expandEmbeds(ctx context.Context, root fs.FS, embeds []string, test bool, add func(GraphFile)) error {
 	var errs []error
 	for _, glob := range embeds {
-		errs = append(errs, expandEmbed(ctx, root, glob, addFile))
+		errs = append(errs, expandEmbed(ctx, root, glob, func(fileName string) {
+			add(GraphFile{Path: fileName, Embed: glob, Test: test})
+		}))
 	}
 	return errors.Join(errs...)
 }
 
+// EmbedError indicates a go:embed pattern that the go command would reject.
+type EmbedError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *EmbedError) Error() string { return fmt.Sprintf("pattern %s: %s", e.Pattern, e.Err) }
+
+func (e *EmbedError) Unwrap() error { return e.Err }
+
+var (
+	// ErrInvalidEmbedPattern indicates a go:embed pattern that is not syntactically
+	// valid, such as patterns containing ".." or empty path elements.
+	ErrInvalidEmbedPattern = errors.New("invalid pattern syntax")
+	// ErrNoMatchingFiles indicates a go:embed pattern that matches no files.
+	ErrNoMatchingFiles = errors.New("no matching files found")
+	// ErrNoEmbeddableFiles indicates a go:embed pattern that matches a directory without
+	// any files that can be embedded.
+	ErrNoEmbeddableFiles = errors.New("contains no embeddable files")
+)
+
+// downgradeEmbedErrors logs each [EmbedError] in err as a warning, returning the
+// remaining errors.
+func downgradeEmbedErrors(ctx context.Context, err error) error {
+	if embedErr, ok := err.(*EmbedError); ok {
+		log.Warn(ctx, embedErr.Error())
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, downgradeEmbedErrors(ctx, err))
+		}
+		return errors.Join(errs...)
+	}
+	return err
+}
+
 // expandEmbed expands a go:embed glob into the files it describes.
 //
 // From https://pkg.go.dev/embed:
@@ -30,45 +76,100 @@ func expandEmbeds(ctx context.Context, root fs.FS, embeds []string, addFile addF
 // match everything in the current directory, use ‘*’ instead of ‘.’. To allow for naming
 // files with spaces in their names, patterns can be written as Go double-quoted or
 // back-quoted string literals.
+//
+// Matching follows the go command: files and directories that would not be packaged into
+// the module (such as nested modules and version control directories) cannot be embedded.
 func expandEmbed(ctx context.Context, dir fs.FS, embed string, addFile addFile) error {
+	pattern := embed
 	if strings.HasPrefix(embed, `"`) ||
 		strings.HasPrefix(embed, "`") {
 		var err error
-		embed, err = strconv.Unquote(embed)
+		pattern, err = strconv.Unquote(embed)
 		if err != nil {
-			return fmt.Errorf("invalid embed - failed to parse string: %w", err)
+			return &EmbedError{Pattern: embed, Err: ErrInvalidEmbedPattern}
 		}
 	}
 
-	if embed == "*" {
-		return embedDir(ctx, dir, ".", addFile)
+	if err := expandEmbedPattern(ctx, dir, pattern, addFile); err != nil {
+		return &EmbedError{Pattern: pattern, Err: err}
 	}
+	return nil
+}
 
-	matches, err := fs.Glob(dir, embed)
+func expandEmbedPattern(ctx context.Context, dir fs.FS, pattern string, addFile addFile) error {
+	// If a pattern begins with the prefix ‘all:’, then the way it walks directories is
+	// changed to include files beginning with ‘.’ or ‘_’.
+	glob, all := strings.CutPrefix(pattern, "all:")
+
+	if _, err := path.Match(glob, ""); err != nil || glob == "." || !fs.ValidPath(glob) {
+		return ErrInvalidEmbedPattern
+	}
+
+	matches, err := fs.Glob(dir, glob)
 	if err != nil {
-		return fmt.Errorf("invalid embed - invalid glob: %w", err)
+		return err
 	}
 
 	var errs []error
+	var count int
 	for _, match := range matches {
-		f, err := dir.Open(match)
+		typ, err := lstatType(dir, match)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("could not read %q: %w", match, err))
+			errs = append(errs, fmt.Errorf("could not get FS info on %q: %w", match, err))
 			continue
 		}
-		s, err := f.Stat()
-		if err != nil {
-			errs = append(errs, fmt.Errorf("could not get FS info on %q: %w", match, err))
+		what := "file"
+		if typ.IsDir() {
+			what = "directory"
+		}
+
+		// Check that the directories along the path would be packaged into the
+		// module.
+		if err := checkEmbedPath(dir, match, what); err != nil {
+			errs = append(errs, err)
 			continue
 		}
-		if s.IsDir() {
-			errs = append(errs, embedDir(ctx, dir, match, addFile))
-		} else {
+
+		switch {
+		case typ.IsRegular():
+			count++
 			addFile(match)
+		case typ.IsDir():
+			n, err := embedDir(ctx, dir, match, all, addFile)
+			if err == nil && n == 0 {
+				err = fmt.Errorf("cannot embed directory %s: %w", match, ErrNoEmbeddableFiles)
+			}
+			count += n
+			errs = append(errs, err)
+		default:
+			errs = append(errs, fmt.Errorf("cannot embed irregular file %s", match))
 		}
 	}
 
-	return errors.Join(errs...)
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNoMatchingFiles
+	}
+	return nil
+}
+
+// checkEmbedPath checks that the file (or directory) at name, and each directory along its
+// path, can be embedded.
+func checkEmbedPath(root fs.FS, name, what string) error {
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		if _, err := fs.Stat(root, path.Join(dir, "go.mod")); err == nil {
+			return fmt.Errorf("cannot embed %s %s: in different module", what, name)
+		}
+		if elem := path.Base(dir); isBadEmbedName(elem) {
+			if dir == name {
+				return fmt.Errorf("cannot embed %s %s: invalid name %s", what, name, elem)
+			}
+			return fmt.Errorf("cannot embed %s %s: in invalid directory %s", what, name, elem)
+		}
+	}
+	return nil
 }
 
 // embedDir expands an entire directory, according to go:embed.
@@ -77,24 +178,74 @@ func expandEmbed(ctx context.Context, dir fs.FS, embed string, addFile addFile)
 //
 // If a pattern names a directory, all files in the subtree rooted at that directory are
 // embedded (recursively), except that files with names beginning with ‘.’ or ‘_’ are
-// excluded. So the variable in the above example is almost equivalent to:
-func embedDir(_ context.Context, root fs.FS, dir string, addFile addFile) error {
-	return fs.WalkDir(root, dir, func(filePath string, d fs.DirEntry, err error) error {
+// excluded. [...] If a pattern begins with the prefix ‘all:’, then the way it walks
+// directories is changed to include those files.
+//
+// Like the go command, the walk stops at module boundaries and skips irregular files.
+//
+// embedDir returns the number of files embedded.
+func embedDir(_ context.Context, root fs.FS, dir string, all bool, addFile addFile) (int, error) {
+	var count int
+	err := fs.WalkDir(root, dir, func(filePath string, d fs.DirEntry, err error) error {
 		if err != nil || dir == filePath {
 			return err
 		}
 
-		if name := path.Base(filePath); strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+		name := d.Name()
+		if isBadEmbedName(name) || (!all && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_"))) {
 			if d.IsDir() {
 				return fs.SkipDir
 			}
-			return nil
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return nil
+			}
+			return fmt.Errorf("cannot embed file %s: invalid name %s", filePath, name)
 		}
-		// Make doesn't play well with directories, so we skip these.
 		if d.IsDir() {
+			// Nested modules are not part of this module.
+			if _, err := fs.Stat(root, path.Join(filePath, "go.mod")); err == nil {
+				return fs.SkipDir
+			}
+			// Make doesn't play well with directories, so we skip these.
 			return nil
 		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		count++
 		addFile(filePath)
 		return nil
 	})
+	return count, err
+}
+
+// isBadEmbedName reports whether name is the base name of a file that can't or won't be
+// included in modules and therefore cannot be embedded.
+func isBadEmbedName(name string) bool {
+	if err := gomodule.CheckFilePath(name); err != nil {
+		return true
+	}
+	switch name {
+	case "", ".bzr", ".hg", ".git", ".svn":
+		return true
+	}
+	return false
+}
+
+// lstatType returns the type of the file at name, without following symbolic links.
+func lstatType(root fs.FS, name string) (fs.FileMode, error) {
+	if name == "." {
+		return fs.ModeDir, nil
+	}
+	entries, err := fs.ReadDir(root, path.Dir(name))
+	if err != nil {
+		return 0, err
+	}
+	base := path.Base(name)
+	for _, e := range entries {
+		if e.Name() == base {
+			return e.Type(), nil
+		}
+	}
+	return 0, fs.ErrNotExist
 }
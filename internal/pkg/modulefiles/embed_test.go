@@ -2,17 +2,24 @@ package modulefiles
 
 import (
 	"context"
+	"os"
 	"path"
+	"path/filepath"
 	"testing"
 
 	"github.com/psanford/memfs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type embedTest struct {
 	fs        []string
 	directive string
 	expected  []string
+	// expectedErr is a substring of the expected error, if any.
+	expectedErr string
+	// expectedErrIs is an error that the expected error wraps, if any.
+	expectedErrIs error
 }
 
 func (tt embedTest) run(t *testing.T) {
@@ -35,6 +42,17 @@ func (tt embedTest) run(t *testing.T) {
 		actual = append(actual, f)
 	})
 
+	if tt.expectedErr != "" || tt.expectedErrIs != nil {
+		var embedErr *EmbedError
+		assert.ErrorAs(t, err, &embedErr)
+		if tt.expectedErr != "" {
+			assert.ErrorContains(t, err, tt.expectedErr)
+		}
+		if tt.expectedErrIs != nil {
+			assert.ErrorIs(t, err, tt.expectedErrIs)
+		}
+		return
+	}
 	if assert.NoError(t, err) {
 		assert.ElementsMatch(t, actual, tt.expected)
 	}
@@ -63,15 +81,61 @@ func TestExpandEmbed(t *testing.T) {
 	}.run)
 
 	t.Run("no-match-glob", embedTest{
-		fs:        []string{"foo.txt", "bar.txt"},
-		directive: "fizz*",
-		expected:  []string{},
+		fs:            []string{"foo.txt", "bar.txt"},
+		directive:     "fizz*",
+		expectedErr:   "pattern fizz*: no matching files found",
+		expectedErrIs: ErrNoMatchingFiles,
 	}.run)
 
 	t.Run("no-match", embedTest{
-		fs:        []string{"foo.txt", "bar.txt"},
-		directive: "fizz.txt",
-		expected:  []string{},
+		fs:            []string{"foo.txt", "bar.txt"},
+		directive:     "fizz.txt",
+		expectedErr:   "pattern fizz.txt: no matching files found",
+		expectedErrIs: ErrNoMatchingFiles,
+	}.run)
+
+	t.Run("invalid-glob", embedTest{
+		fs:            []string{"foo.txt"},
+		directive:     "foo[",
+		expectedErr:   "pattern foo[: invalid pattern syntax",
+		expectedErrIs: ErrInvalidEmbedPattern,
+	}.run)
+
+	t.Run("parent-dir", embedTest{
+		fs:            []string{"foo.txt"},
+		directive:     "../foo.txt",
+		expectedErrIs: ErrInvalidEmbedPattern,
+	}.run)
+
+	t.Run("dot", embedTest{
+		fs:            []string{"foo.txt"},
+		directive:     ".",
+		expectedErrIs: ErrInvalidEmbedPattern,
+	}.run)
+
+	t.Run("trailing-slash", embedTest{
+		fs:            []string{"d/foo.txt"},
+		directive:     "d/",
+		expectedErrIs: ErrInvalidEmbedPattern,
+	}.run)
+
+	t.Run("bad-quote", embedTest{
+		fs:            []string{"foo.txt"},
+		directive:     `"foo.txt`,
+		expectedErrIs: ErrInvalidEmbedPattern,
+	}.run)
+
+	t.Run("empty-dir", embedTest{
+		fs:            []string{"d/_foo", "d/.bar"},
+		directive:     "d",
+		expectedErr:   "pattern d: cannot embed directory d: contains no embeddable files",
+		expectedErrIs: ErrNoEmbeddableFiles,
+	}.run)
+
+	t.Run("empty-dir-all", embedTest{
+		fs:        []string{"d/_foo", "d/.bar"},
+		directive: "all:d",
+		expected:  []string{"d/_foo", "d/.bar"},
 	}.run)
 
 	t.Run("dir", embedTest{
@@ -101,6 +165,78 @@ func TestExpandEmbed(t *testing.T) {
 	t.Run("exclude-special", embedTest{
 		fs:        []string{"d/_foo", "d/bar", "_foo", ".ignored", "d/.ignored"},
 		directive: "*",
+		// Files matched directly are embedded, even when they would be excluded
+		// from a directory.
+		expected: []string{"d/bar", "_foo", ".ignored"},
+	}.run)
+
+	t.Run("all-prefix", embedTest{
+		fs:        []string{"d/_foo", "d/bar", "d/.ignored", "d/.sub/baz", "_foo"},
+		directive: "all:d",
+		expected:  []string{"d/_foo", "d/bar", "d/.ignored", "d/.sub/baz"},
+	}.run)
+
+	t.Run("all-prefix-glob", embedTest{
+		fs:        []string{"d/_foo", "d/bar", "e/_foo"},
+		directive: "all:*",
+		expected:  []string{"d/_foo", "d/bar", "e/_foo"},
+	}.run)
+
+	t.Run("all-prefix-quoted", embedTest{
+		fs:        []string{"my dir/_foo", "my dir/bar"},
+		directive: `"all:my dir"`,
+		expected:  []string{"my dir/_foo", "my dir/bar"},
+	}.run)
+
+	t.Run("exclude-vcs", embedTest{
+		fs:        []string{"d/.git/HEAD", "d/.hg/store", "d/bar"},
+		directive: "all:d",
 		expected:  []string{"d/bar"},
 	}.run)
+
+	t.Run("exclude-nested-module", embedTest{
+		fs:        []string{"d/bar", "d/mod/go.mod", "d/mod/foo"},
+		directive: "d",
+		expected:  []string{"d/bar"},
+	}.run)
+
+	t.Run("nested-module", embedTest{
+		fs:          []string{"d/go.mod", "d/foo"},
+		directive:   "d/foo",
+		expectedErr: "cannot embed file d/foo: in different module",
+	}.run)
+
+	t.Run("vcs-directory", embedTest{
+		fs:          []string{".git/HEAD"},
+		directive:   ".git/HEAD",
+		expectedErr: "cannot embed file .git/HEAD: in invalid directory .git",
+	}.run)
+}
+
+func TestExpandEmbedIrregular(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "target"), []byte("content"), 0600))
+	require.NoError(t, os.Symlink("target", filepath.Join(dir, "link")))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "d"), 0700))
+	require.NoError(t, os.Symlink("../target", filepath.Join(dir, "d", "link")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "d", "file"), []byte("content"), 0600))
+
+	t.Run("direct", func(t *testing.T) {
+		t.Parallel()
+		err := expandEmbed(context.Background(), os.DirFS(dir), "link", func(string) {})
+		assert.ErrorContains(t, err, "cannot embed irregular file link")
+	})
+
+	t.Run("in-directory", func(t *testing.T) {
+		t.Parallel()
+		var actual []string
+		err := expandEmbed(context.Background(), os.DirFS(dir), "d", func(f string) {
+			actual = append(actual, f)
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"d/file"}, actual)
+		}
+	})
 }
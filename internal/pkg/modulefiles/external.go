@@ -0,0 +1,156 @@
+package modulefiles
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	gomodule "golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+)
+
+// externalModule is a module that is resolved from the module cache.
+type externalModule struct {
+	path, version string
+	// dir is the directory that the module is extracted to in the module cache.
+	dir string
+}
+
+// ModCacheDir returns the module cache directory that external modules are resolved
+// from, or "" if it cannot be determined.
+func (c Config) ModCacheDir() string {
+	if c.GOMODCACHE != "" {
+		return c.GOMODCACHE
+	}
+	// Like the go command, GOMODCACHE defaults to the pkg/mod subdirectory of the
+	// first GOPATH entry.
+	gopath := filepath.SplitList(build.Default.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+// externalModules computes the modules that non-local imports resolve to, and where
+// they live in the module cache at modCache.
+//
+// Versions are selected from the require directives of the main modules (which are
+// complete for go 1.17+ modules), honoring non-local replace directives. The result is
+// sorted (longest to shortest) on .path, so a linear search will pick up the most specific
+// module first.
+func externalModules(
+	ctx context.Context, mainModules []*modfile.File, workReplaces []*modfile.Replace, modCache string,
+) ([]externalModule, error) {
+	// Select the highest required version of each module.
+	versions := map[string]string{}
+	for _, f := range mainModules {
+		for _, r := range f.Require {
+			if v, ok := versions[r.Mod.Path]; !ok || semver.Compare(v, r.Mod.Version) < 0 {
+				versions[r.Mod.Path] = r.Mod.Version
+			}
+		}
+	}
+
+	// Replaces from go.work take precedence over those in any go.mod, so they are
+	// applied last.
+	replaces := map[string]gomodule.Version{}
+	applyReplaces := func(rs []*modfile.Replace) {
+		for _, r := range rs {
+			if modfile.IsDirectoryPath(r.New.Path) {
+				continue // Local replaces are handled by packageFinder.replaces
+			}
+			if r.Old.Version != "" && r.Old.Version != versions[r.Old.Path] {
+				continue // This replace doesn't apply to the selected version
+			}
+			replaces[r.Old.Path] = r.New
+		}
+	}
+	for _, f := range mainModules {
+		applyReplaces(f.Replace)
+	}
+	applyReplaces(workReplaces)
+
+	modules := make([]externalModule, 0, len(versions))
+	for path, version := range versions {
+		target := gomodule.Version{Path: path, Version: version}
+		if r, ok := replaces[path]; ok {
+			log.Debug(ctx, "Replacing external module",
+				log.Attr("from", path), log.Attr("to", r.String()))
+			target = r
+		}
+
+		escapedPath, err := gomodule.EscapePath(target.Path)
+		if err != nil {
+			return nil, err
+		}
+		escapedVersion, err := gomodule.EscapeVersion(target.Version)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, externalModule{
+			path:    path,
+			version: target.String(),
+			dir:     filepath.Join(modCache, filepath.FromSlash(escapedPath)+"@"+escapedVersion),
+		})
+	}
+	slices.SortFunc(modules, func(a, b externalModule) int {
+		// this is a reverse sort on .path
+		return strings.Compare(b.path, a.path)
+	})
+	return modules, nil
+}
+
+// fromExternal resolves _import into the module cache, if external modules are enabled.
+//
+// Imports that are not provided by any required module (such as standard library
+// imports) are not resolved.
+func (pf *packageFinder) fromExternal(ctx context.Context, _import string) (string, bool, error) {
+	for _, m := range pf.externals {
+		rest, ok := moduleCovers(_import, m.path)
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(m.dir); os.IsNotExist(err) {
+			return "", false, fmt.Errorf("module %s is not in the module cache: run 'go mod download'", m.version)
+		} else if err != nil {
+			return "", false, err
+		}
+		// Register the module, so its go.mod is reported like any other module.
+		if _, err := os.Stat(filepath.Join(m.dir, "go.mod")); err == nil {
+			if _, err := pf.modules.findGoMod(ctx, m.dir); err != nil {
+				return "", false, err
+			}
+		}
+		return filepath.Join(m.dir, filepath.FromSlash(rest)), true, nil
+	}
+	return "", false, nil
+}
+
+// isExternal checks if dir belongs to an external module.
+func (pf *packageFinder) isExternal(dir string) bool {
+	_, ok := pf.externalModule(dir)
+	return ok
+}
+
+// externalModule returns the external module that dir belongs to, if any.
+func (pf *packageFinder) externalModule(dir string) (externalModule, bool) {
+	for _, m := range pf.externals {
+		if isWithin(m.dir, dir) {
+			return m, true
+		}
+	}
+	return externalModule{}, false
+}
+
+// isWithin checks if path is parent or one of its descendants.
+func isWithin(parent, path string) bool {
+	rel, err := filepath.Rel(parent, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"go/build"
 	"iter"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
@@ -17,73 +18,183 @@ import (
 	"golang.org/x/mod/modfile"
 )
 
-// Find the set of files that are depended on by the package at root.
-func Find(ctx context.Context, root string, testPaths, modFiles, goWork bool) ([]string, error) {
-	return findWithModules(ctx, root, testPaths, modFiles, goWork, new(modules), &build.Default)
+// Find the set of files that are depended on by the packages at roots when built under
+// config.
+//
+// All roots are resolved in a single walk, so packages shared between roots are only
+// visited once. Like the go command, every root must belong to the main modules: the
+// module of the first root, and the modules used by its workspace.
+func Find(ctx context.Context, roots []string, testPaths, modFiles, goWork bool, config Config) ([]string, error) {
+	graph, err := FindGraph(ctx, roots, testPaths, modFiles, goWork, config)
+	if graph == nil {
+		return nil, err
+	}
+	return graph.findResult(config), err
 }
 
-// Find the set of files that are depended on by the package at root.
-func findWithModules(
-	ctx context.Context, root string,
-	testPaths, modFiles, goWork bool,
-	modules *modules, importer interface {
-		ImportDir(string, build.ImportMode) (*build.Package, error)
-	},
-) ([]string, error) {
+// importer resolves a directory into the package it contains.
+//
+// [*build.Context] is the canonical importer.
+type importer interface {
+	ImportDir(dir string, mode build.ImportMode) (*build.Package, error)
+}
+
+// Find the graph of packages reached from the packages at roots.
+func findGraph(
+	ctx context.Context, roots []string,
+	testPaths, modFiles, goWork bool, config Config,
+	modules *modules, newImporter func(Config) importer,
+) (*Graph, error) {
 	var errs []error
 
-	files := map[string]struct{}{}
+	graph := newGraph()
 	if os.Getenv("GO111MODULE") == "off" {
 		return nil, fmt.Errorf("go modules disabled")
 	}
+	if len(roots) == 0 {
+		return nil, errors.New("no packages to find")
+	}
+	// The main module is decided by the first root.
+	root := roots[0]
+	mainModule, err := modules.findGoMod(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	graph.MainModule = mainModule.rootDir
+
+	// The toolchain that builds the package decides which release tags are
+	// satisfied, so we need to know it before we can import any package.
+	goVersion, err := config.resolveGoVersion(ctx, root, goWork, modules, localGoVersion)
+	if err != nil {
+		return nil, err
+	}
+	// The version of the local toolchain is only a guess (see localGoVersion), which
+	// RequiredGoVersion leaves out.
+	graph.RequiredGoVersion, err = config.resolveGoVersion(ctx, root, goWork, modules, "")
+	if err != nil {
+		return nil, err
+	}
+	config.GoVersion = goVersion
+	log.Debug(ctx, "resolved go version", log.Attr("version", goVersion))
 
-	packages, workspace, err := findPackages(ctx, root, testPaths, goWork, modules, importer)
+	vendorDir, err := modules.vendorDir(ctx, root, goWork, config)
 	if err != nil {
 		return nil, err
 	}
-	for pkg, err := range packages {
+
+	graph.Config = config.resolved(vendorDir != "")
+
+	// Vendored builds never consult the module cache.
+	var modCache string
+	if config.External && vendorDir == "" {
+		modCache = config.ModCacheDir()
+		if modCache == "" {
+			return nil, errors.New("unable to locate the module cache: GOMODCACHE and GOPATH are unset")
+		}
+	}
+
+	// Each platform has its own import graph, so we walk the graph once per
+	// platform. Walks share modules, so go.mod files are only parsed once.
+	var workspace *goWorkspace
+	for _, config := range config.platforms() {
+		packages, ws, err := findPackages(ctx, roots, testPaths, goWork, vendorDir, modCache, modules, newImporter(config))
 		if err != nil {
+			return nil, err
+		}
+		workspace = ws
+		cgoEnabled := config.buildContext().CgoEnabled
+		var found []foundPackage
+		for pkg, err := range packages {
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if pkg == nil {
+				continue
+			}
+			found = append(found, *pkg)
+
+			graphPkg := graph.addPackage(*pkg)
+			add := func(f GraphFile) {
+				f.Path = filepath.Join(pkg.Dir, f.Path)
+				graphPkg.addFile(f)
+			}
+			err := importPackage(ctx, pkg.Package, testPaths, cgoEnabled, add)
+			if config.EmbedWarnings {
+				err = downgradeEmbedErrors(log.WithAttr(ctx, "package", pkg.Dir), err)
+			}
 			errs = append(errs, err)
+			errs = append(errs, addIncludes(ctx, pkg.Package, modules, cgoEnabled, func(fileName string) {
+				add(GraphFile{Path: fileName})
+			}))
 		}
-		if pkg == nil {
-			continue
+		// Imports can only be resolved once every package of the walk is known.
+		for _, pkg := range found {
+			graph.addImports(graph.Packages[pkg.importPath], pkg, testPaths)
 		}
-
-		errs = append(errs, importPackage(ctx, pkg, testPaths, func(fileName string) {
-			files[filepath.Join(pkg.Dir, fileName)] = struct{}{}
-		}))
 	}
 
-	if modFiles {
-		(*sync.Map)(modules).Range(func(_, m any) bool {
-			errs = append(errs, m.(module).addRootFiles(files))
+	// modules can be shared with other lookups, so only the modules of the graph's
+	// packages and the main modules belong to the graph.
+	inGraph := map[string]struct{}{}
+	for _, pkg := range graph.Packages {
+		inGraph[pkg.Module] = struct{}{}
+	}
+	if workspace != nil {
+		for _, u := range workspace.file.Use {
+			inGraph[filepath.Join(workspace.rootDir, filepath.FromSlash(u.Path))] = struct{}{}
+		}
+	}
+	modules.dirs.Range(func(_, m any) bool {
+		mod := m.(module)
+		if _, ok := inGraph[mod.rootDir]; !ok {
 			return true
-		})
+		}
+		if _, ok := graph.Modules[mod.rootDir]; ok {
+			return true
+		}
+		graphMod := &GraphModule{Path: mod.file.Module.Mod.Path, Dir: mod.rootDir}
+		if modFiles {
+			files := map[string]struct{}{}
+			errs = append(errs, mod.addRootFiles(files))
+			graphMod.Files = slices.Sorted(maps.Keys(files))
+		}
+		graph.Modules[mod.rootDir] = graphMod
+		return true
+	})
+	if modFiles {
+		files := map[string]struct{}{}
 		if workspace != nil {
 			errs = append(errs, workspace.addRootFiles(files))
 		}
+		if vendorDir != "" {
+			errs = append(errs, addVendorFiles(vendorDir, files))
+		}
+		graph.Files = slices.Sorted(maps.Keys(files))
 	}
 
-	sortedFiles := make([]string, 0, len(files))
-	for file := range files {
-		sortedFiles = append(sortedFiles, file)
+	for _, pkg := range graph.Packages {
+		slices.SortFunc(pkg.Files, func(a, b GraphFile) int { return strings.Compare(a.Path, b.Path) })
+		slices.SortFunc(pkg.Imports, func(a, b GraphImport) int { return strings.Compare(a.ImportPath, b.ImportPath) })
+		pkg.fileIndex = nil
 	}
-	slices.Sort(sortedFiles)
-	return sortedFiles, errors.Join(errs...)
+	return graph, errors.Join(errs...)
 }
 
-func importPackage(ctx context.Context, pkg *build.Package, includeTests bool, addFile addFile) error {
+// importPackage adds the files that pkg depends on, relative to pkg.Dir.
+func importPackage(ctx context.Context, pkg *build.Package, includeTests, cgoEnabled bool, add func(GraphFile)) error {
+	addFile := func(fileName string) { add(GraphFile{Path: fileName}) }
+
 	var errs []error
-	errs = append(errs, expandEmbeds(ctx, os.DirFS(pkg.Dir), pkg.EmbedPatterns, addFile))
+	errs = append(errs, expandEmbeds(ctx, os.DirFS(pkg.Dir), pkg.EmbedPatterns, false, add))
 	if includeTests {
 		// Include test files
-		applyNested(addFile,
+		applyNested(func(fileName string) { add(GraphFile{Path: fileName, Test: true}) },
 			pkg.TestGoFiles,
 			pkg.XTestGoFiles,
 		)
 		// Include test embeds
-		errs = append(errs, expandEmbeds(ctx, os.DirFS(pkg.Dir), pkg.TestEmbedPatterns, addFile))
-		errs = append(errs, expandEmbeds(ctx, os.DirFS(pkg.Dir), pkg.XTestEmbedPatterns, addFile))
+		errs = append(errs, expandEmbeds(ctx, os.DirFS(pkg.Dir), pkg.TestEmbedPatterns, true, add))
+		errs = append(errs, expandEmbeds(ctx, os.DirFS(pkg.Dir), pkg.XTestEmbedPatterns, true, add))
 	}
 
 	applyNested(addFile,
@@ -91,46 +202,64 @@ func importPackage(ctx context.Context, pkg *build.Package, includeTests bool, a
 		pkg.CgoFiles,       // .go source files that import "C"
 		pkg.IgnoredGoFiles, // .go source files ignored for this build (including ignored _test.go files)
 		pkg.InvalidGoFiles, // .go source files with detected problems (parse error, wrong package name, and so on)
-		pkg.CFiles,         // .c source files
-		pkg.CXXFiles,       // .cc, .cpp and .cxx source files
-		pkg.MFiles,         // .m (Objective-C) source files
 		pkg.HFiles,         // .h, .hh, .hpp and .hxx source files
 		pkg.FFiles,         // .f, .F, .for and .f90 Fortran source files
 		pkg.SFiles,         // .s source files
-		pkg.SwigFiles,      // .swig files
-		pkg.SwigCXXFiles,   // .swigcxx files
 		pkg.SysoFiles,      // .syso system object files to add to archive
 	)
 
+	// Like the go command, we ignore cgo supporting sources when cgo is disabled.
+	//
+	// CgoFiles don't need special handling: go/build already reports them as
+	// IgnoredGoFiles (without their imports) when cgo is disabled.
+	if cgoEnabled {
+		applyNested(addFile,
+			pkg.CFiles,       // .c source files
+			pkg.CXXFiles,     // .cc, .cpp and .cxx source files
+			pkg.MFiles,       // .m (Objective-C) source files
+			pkg.SwigFiles,    // .swig files
+			pkg.SwigCXXFiles, // .swigcxx files
+		)
+	}
+
 	return errors.Join(errs...)
 }
 
 type addFile = func(fileName string)
 
 func findPackages(
-	ctx context.Context, root string,
-	includeTests, goWorkEnv bool,
-	modules *modules, importer interface {
-		ImportDir(string, build.ImportMode) (*build.Package, error)
-	},
-) (iter.Seq2[*build.Package, error], *goWorkspace, error) {
+	ctx context.Context, roots []string,
+	includeTests, goWorkEnv bool, vendorDir, modCache string,
+	modules *modules, importer importer,
+) (iter.Seq2[*foundPackage, error], *goWorkspace, error) {
+	root := roots[0]
 	goMod, err := modules.findGoMod(ctx, root)
 	if err != nil {
 		log.Debug(ctx, "unable to find initial go.mod")
 		return nil, nil, err
 	}
 
+	// When vendoring, replaced modules are resolved from the vendor directory like any
+	// other module, so we don't follow replaces.
+	vendoring := vendorDir != ""
+
 	// Find the go.mod
-	replaces := make(map[string]string, len(goMod.file.Replace))
+	replaces := make(map[string]replace, len(goMod.file.Replace))
 	for _, r := range goMod.file.Replace {
 		// We only follow local replaces
-		if !modfile.IsDirectoryPath(r.New.Path) {
+		if !modfile.IsDirectoryPath(r.New.Path) || vendoring {
 			continue
 		}
 		log.Info(ctx, "Added replace", log.Attr("from", r.Old.Path), log.Attr("to", r.New.Path))
-		replaces[r.Old.Path] = filepath.Join(goMod.rootDir, r.New.Path) // Resolve to a better path
+		replaces[r.Old.Path] = replace{ // Resolve to a better path
+			from: r.Old.Path, to: filepath.Join(goMod.rootDir, r.New.Path), via: ResolvedReplace,
+		}
 	}
 
+	// The main modules decide which versions of external modules are used.
+	mainModules := []*modfile.File{goMod.file}
+	mainModuleDirs := []string{goMod.rootDir}
+
 	// Find the go.work, if any and if its not disabled.
 	var goWork *goWorkspace
 	if !goWorkEnv {
@@ -145,10 +274,12 @@ func findPackages(
 			// Apply replaces from go.work
 			for _, r := range goWork.file.Replace {
 				// We only follow local replaces
-				if !modfile.IsDirectoryPath(r.New.Path) {
+				if !modfile.IsDirectoryPath(r.New.Path) || vendoring {
 					continue
 				}
-				replaces[r.Old.Path] = filepath.Join(goWork.rootDir, r.New.Path) // Resolve to a better path
+				replaces[r.Old.Path] = replace{ // Resolve to a better path
+					from: r.Old.Path, to: filepath.Join(goWork.rootDir, r.New.Path), via: ResolvedReplace,
+				}
 			}
 
 			// Apply `use` statements
@@ -163,21 +294,55 @@ func findPackages(
 					continue
 				}
 				// For our purposes, each `use` statement resolves like a replace statement.
-				replaces[mod.file.Module.Mod.Path] = modDir
+				replaces[mod.file.Module.Mod.Path] = replace{
+					from: mod.file.Module.Mod.Path, to: modDir, via: ResolvedWorkspace,
+				}
+				mainModules = append(mainModules, mod.file)
+				mainModuleDirs = append(mainModuleDirs, mod.rootDir)
 			}
 		}
 	}
 
-	incoming := make(chan *build.Package, 50)
+	// Each root must be in a main module. We know the import path of each root, so
+	// they are marked as seen before the walk starts: roots that import each other are
+	// only visited once.
+	rootImports := make([]string, len(roots))
+	var rootModules []string
+	for i, root := range roots {
+		mod, err := modules.findGoMod(ctx, root)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !slices.Contains(mainModuleDirs, mod.rootDir) {
+			return nil, nil, fmt.Errorf("directory %s is outside the main modules", root)
+		}
+		if !slices.Contains(rootModules, mod.rootDir) {
+			rootModules = append(rootModules, mod.rootDir)
+		}
+		rel, err := filepath.Rel(mod.rootDir, root)
+		if err != nil {
+			return nil, nil, err
+		}
+		rootImports[i] = path.Join(mod.file.Module.Mod.Path, filepath.ToSlash(rel))
+	}
+
+	var externals []externalModule
+	if modCache != "" {
+		var workReplaces []*modfile.Replace
+		if goWork != nil {
+			workReplaces = goWork.file.Replace
+		}
+		externals, err = externalModules(ctx, mainModules, workReplaces, modCache)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	incoming := make(chan *foundPackage, 50)
 
 	ctx, cancel := context.WithCancelCause(ctx)
 
-	_replaces := make([]replace, 0, len(replaces))
-	for k, v := range replaces {
-		_replaces = append(_replaces, replace{
-			from: k, to: v,
-		})
-	}
+	_replaces := slices.Collect(maps.Values(replaces))
 	slices.SortFunc(_replaces, func(a, b replace) int {
 		// this is a reverse sort on .from
 		return strings.Compare(b.from, a.from)
@@ -185,6 +350,9 @@ func findPackages(
 
 	finder := packageFinder{
 		replaces:     _replaces,
+		rootModules:  rootModules,
+		vendorDir:    vendorDir,
+		externals:    externals,
 		includeTests: includeTests,
 		modules:      modules,
 		importer:     importer,
@@ -192,15 +360,20 @@ func findPackages(
 		dst:          incoming,
 	}
 
-	finder.wg.Add(1)
-	go finder.findPackages(ctx, root, "")
+	for i, root := range roots {
+		if _, ok := finder.seen.LoadOrStore(rootImports[i], struct{}{}); ok {
+			continue
+		}
+		finder.wg.Add(1)
+		go finder.findPackages(ctx, root, rootImports[i], true)
+	}
 
 	// Close incoming when we have indicated that no more
 	//
 	// This allows the iterator to detect when it should exit.
 	go func() { finder.wg.Wait(); close(incoming) }()
 
-	return func(yield func(*build.Package, error) bool) {
+	return func(yield func(*foundPackage, error) bool) {
 		// Make sure to avoid leaking the cancel request.
 		defer cancel(nil)
 
@@ -233,12 +406,18 @@ type packageFinder struct {
 
 	// replaces must be sorted (longest to shortest) on .from so a linear search will
 	// pick up the correct module first.
-	replaces     []replace
+	replaces []replace
+	// rootModules holds the root directories of the modules that provide the roots.
+	rootModules []string
+	// vendorDir is the vendor directory that foreign imports are resolved against, or
+	// "" when not vendoring.
+	vendorDir string
+	// externals are the modules that foreign imports are resolved against in the
+	// module cache, sorted like replaces.
+	externals    []externalModule
 	includeTests bool
 
-	importer interface {
-		ImportDir(string, build.ImportMode) (*build.Package, error)
-	}
+	importer importer
 
 	// Local state, may mutate and thus must be safe to mutate in parallel.
 
@@ -248,19 +427,36 @@ type packageFinder struct {
 	// seen is a cache of modules already processed.
 	seen sync.Map // Map of string -> struct{}
 
-	dst chan<- *build.Package
+	dst chan<- *foundPackage
 
 	wg sync.WaitGroup
 
 	cancel func(error)
 }
 
-type replace struct{ from, to string }
+type replace struct {
+	from, to string
+	// via is either ResolvedReplace or ResolvedWorkspace.
+	via Resolution
+}
+
+// foundPackage is a package reached by a packageFinder.
+type foundPackage struct {
+	*build.Package
+	importPath string
+	// module is the root directory of the module providing the package, if known.
+	module string
+	via    Resolution
+}
 
 // A lookup table from directory names to the go module they represent.
-//
-// The underlying map is of string -> module
-type modules sync.Map
+type modules struct {
+	dirs sync.Map // Map of string -> module
+
+	// watch, if set, is called with each go.mod file before it is read (see
+	// [NewWatchedCache]).
+	watch func(files, dirs []string)
+}
 
 type module struct {
 	file    *modfile.File
@@ -278,18 +474,22 @@ func (m *modules) findGoMod(ctx context.Context, root string) (mod module, err e
 	for {
 		log.Debug(ctx, "Searching for go.mod", log.Attr("haystack", goModDir))
 		// Check the cache
-		if mod, ok := (*sync.Map)(m).Load(root); ok {
+		if mod, ok := m.dirs.Load(root); ok {
 			return mod.(module), nil
 		}
 
 		// Cache this dir to the module we eventually found.
 		defer func(path string) {
 			if err == nil {
-				(*sync.Map)(m).Store(path, mod)
+				m.dirs.Store(path, mod)
 			}
 		}(goModDir)
 
-		if b, err := os.ReadFile(filepath.Join(goModDir, "go.mod")); err == nil {
+		goModPath := filepath.Join(goModDir, "go.mod")
+		if m.watch != nil {
+			m.watch([]string{goModPath}, nil)
+		}
+		if b, err := os.ReadFile(goModPath); err == nil {
 			goModBytes = b
 			break
 		} else if os.IsNotExist(err) {
@@ -377,7 +577,7 @@ func (m module) addRootFiles(files map[string]struct{}) error {
 	return nil
 }
 
-func (pf *packageFinder) findPackages(ctx context.Context, target string, pkgName string) {
+func (pf *packageFinder) findPackages(ctx context.Context, target, pkgName string, isRoot bool) {
 	log.Debug(ctx, "searching for imports of", log.Attr("target", target))
 	// Decrement the wait grounp associated with this function
 	// call.
@@ -386,11 +586,17 @@ func (pf *packageFinder) findPackages(ctx context.Context, target string, pkgNam
 	// findPackages in a background thread.
 	defer pf.wg.Done()
 
-	goMod, err := pf.modules.findGoMod(ctx, target)
-	if err != nil {
-		log.Debug(ctx, "failed to find go.mod for", log.Attr("target", target))
-		pf.cancel(err)
-		return
+	// Vendored and external packages might not have a go.mod: every import they make is
+	// resolved as a foreign import.
+	var goMod module
+	if !pf.isVendored(target) && !pf.isExternal(target) {
+		var err error
+		goMod, err = pf.modules.findGoMod(ctx, target)
+		if err != nil {
+			log.Debug(ctx, "failed to find go.mod for", log.Attr("target", target))
+			pf.cancel(err)
+			return
+		}
 	}
 
 	pkg, err := pf.importer.ImportDir(target, 0)
@@ -403,20 +609,46 @@ func (pf *packageFinder) findPackages(ctx context.Context, target string, pkgNam
 		pf.cancel(fmt.Errorf("cannot import dir: %w", err))
 		return
 	}
-	pf.dst <- pkg
+	found := &foundPackage{Package: pkg, importPath: pkgName, module: goMod.rootDir, via: ResolvedRoot}
+	if m, ok := pf.externalModule(target); ok {
+		found.module = m.dir
+	}
+	if !isRoot {
+		found.via = pf.resolution(target, goMod.rootDir)
+	}
+	pf.dst <- found
 
 	searchImport := func(_import string) {
 		if _, ok := pf.seen.LoadOrStore(_import, struct{}{}); ok {
 			log.Debug(ctx, "Skipping repeated import", log.Attr("module", _import))
 			return
 		}
-		rest, isInModule := moduleCovers(_import, goMod.file.Module.Mod.Path)
+		var rest string
+		var isInModule bool
+		if goMod.file != nil {
+			rest, isInModule = moduleCovers(_import, goMod.file.Module.Mod.Path)
+		}
 		if !isInModule {
 			if replaceTarget, ok := pf.fromReplace(_import); ok {
 				log.Debug(ctx, "Replacing import",
 					log.Attr("from", _import), log.Attr("to", replaceTarget))
 				pf.wg.Add(1)
-				go pf.findPackages(ctx, replaceTarget, _import)
+				go pf.findPackages(ctx, replaceTarget, _import, false)
+				return
+			} else if vendorTarget, ok := pf.fromVendor(_import); ok {
+				log.Debug(ctx, "Vendoring import",
+					log.Attr("from", _import), log.Attr("to", vendorTarget))
+				pf.wg.Add(1)
+				go pf.findPackages(ctx, vendorTarget, _import, false)
+				return
+			} else if externalTarget, ok, err := pf.fromExternal(ctx, _import); err != nil {
+				pf.cancel(err)
+				return
+			} else if ok {
+				log.Debug(ctx, "Resolving external import",
+					log.Attr("from", _import), log.Attr("to", externalTarget))
+				pf.wg.Add(1)
+				go pf.findPackages(ctx, externalTarget, _import, false)
 				return
 			} else {
 				log.Debug(ctx, "Skipping foreign import", log.Attr("module", _import))
@@ -424,7 +656,7 @@ func (pf *packageFinder) findPackages(ctx context.Context, target string, pkgNam
 			}
 		}
 		pf.wg.Add(1)
-		go pf.findPackages(ctx, filepath.Join(goMod.rootDir, rest), _import)
+		go pf.findPackages(ctx, filepath.Join(goMod.rootDir, rest), _import, false)
 	}
 
 	log.Debug(ctx, "finding transitive imports",
@@ -464,6 +696,48 @@ func (pf *packageFinder) fromReplace(_import string) (string, bool) {
 	return "", false
 }
 
+// resolution describes how the package in dir, provided by the module at modDir, is
+// resolved.
+//
+// A package can be reached by several imports (such as from its own module and through a
+// replace), so the resolution is decided by the module that provides the package rather
+// than by the import that reached it first.
+func (pf *packageFinder) resolution(dir, modDir string) Resolution {
+	switch {
+	case pf.isVendored(dir):
+		return ResolvedVendor
+	case pf.isExternal(dir):
+		return ResolvedExternal
+	case slices.Contains(pf.rootModules, modDir):
+		return ResolvedModule
+	}
+	for _, replace := range pf.replaces {
+		if filepath.Clean(replace.to) == modDir {
+			return replace.via
+		}
+	}
+	return ResolvedModule
+}
+
+// fromVendor resolves _import into the vendor directory, if vendoring.
+//
+// Imports without a vendored package (such as standard library imports) are not resolved.
+func (pf *packageFinder) fromVendor(_import string) (string, bool) {
+	if pf.vendorDir == "" {
+		return "", false
+	}
+	dir := filepath.Join(pf.vendorDir, filepath.FromSlash(_import))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+// isVendored checks if dir is inside of the vendor directory.
+func (pf *packageFinder) isVendored(dir string) bool {
+	return pf.vendorDir != "" && isWithin(pf.vendorDir, dir)
+}
+
 // moduleCovers should be used to check if _import should be covered by the module path from.
 //
 // It will return the non-covered suffix and true if _import should be covered by from.
@@ -17,9 +17,14 @@ type testFindArgs struct {
 
 	expected []string // Files that Find is expected to surface.
 	runDir   string   // The path to the entry point in files.
+	runDirs  []string // The paths to multiple entry points in files, overriding runDir.
 
 	includeTestFiles bool
 	excludeModFiles  bool
+
+	config Config
+	// modCache is the path in files to use as GOMODCACHE, if any.
+	modCache string
 }
 
 func testFind(t *testing.T, args testFindArgs) {
@@ -39,8 +44,20 @@ func testFind(t *testing.T, args testFindArgs) {
 		assert.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
 	}
 
+	if args.modCache != "" {
+		args.config.GOMODCACHE = filepath.Join(tmpDir, args.modCache)
+	}
+
+	roots := []string{path.Join(tmpDir, args.runDir)}
+	if len(args.runDirs) > 0 {
+		roots = nil
+		for _, dir := range args.runDirs {
+			roots = append(roots, path.Join(tmpDir, dir))
+		}
+	}
+
 	// Run the Find function
-	files, err := Find(ctx, path.Join(tmpDir, args.runDir), args.includeTestFiles, !args.excludeModFiles, true /* GOWORK != off */)
+	files, err := Find(ctx, roots, args.includeTestFiles, !args.excludeModFiles, true /* GOWORK != off */, args.config)
 	if assert.NoError(t, err) {
 		assert.ElementsMatch(t, args.expected, display.Relative(ctx, tmpDir, files))
 	}
@@ -398,6 +415,818 @@ func TestMessage(t *testing.T) string {
 	})
 }
 
+func TestFindBuildTags(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"go.mod": `module example.com/testmod
+
+go 1.18
+`,
+		"main.go": `package main
+
+func main() {}
+`,
+		"integration.go": `//go:build integration
+
+package main
+
+import _ "example.com/testmod/pkg"
+`,
+		"pkg/pkg.go": `package pkg
+`,
+	}
+
+	t.Run("without-tag", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files: files,
+			expected: []string{
+				"go.mod",
+				"main.go",
+				"integration.go",
+			},
+		})
+	})
+
+	t.Run("with-tag", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:  files,
+			config: Config{Tags: []string{"integration"}},
+			expected: []string{
+				"go.mod",
+				"main.go",
+				"integration.go",
+				"pkg/pkg.go",
+			},
+		})
+	})
+}
+
+func TestFindCrossPlatform(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"go.mod": `module example.com/testmod
+
+go 1.18
+`,
+		"main.go": `package main
+
+func main() {}
+`,
+		"main_windows.go": `package main
+
+import _ "example.com/testmod/win"
+`,
+		"main_arm64.go": `package main
+
+import _ "example.com/testmod/arm"
+`,
+		"win/win.go": `package win
+`,
+		"arm/arm.go": `package arm
+`,
+	}
+
+	t.Run("linux/amd64", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:  files,
+			config: Config{GOOS: "linux", GOARCH: "amd64"},
+			expected: []string{
+				"go.mod",
+				"main.go",
+				"main_windows.go",
+				"main_arm64.go",
+			},
+		})
+	})
+
+	t.Run("windows/arm64", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:  files,
+			config: Config{GOOS: "windows", GOARCH: "arm64"},
+			expected: []string{
+				"go.mod",
+				"main.go",
+				"main_windows.go",
+				"main_arm64.go",
+				"win/win.go",
+				"arm/arm.go",
+			},
+		})
+	})
+}
+
+func TestFindPlatformUnion(t *testing.T) {
+	t.Parallel()
+	testFind(t, testFindArgs{
+		files: map[string]string{
+			"go.mod": `module example.com/testmod
+
+go 1.18
+`,
+			"main.go": `package main
+
+func main() {}
+`,
+			"main_windows.go": `package main
+
+import _ "example.com/testmod/win"
+`,
+			"main_darwin.go": `package main
+
+import _ "example.com/testmod/darwin"
+`,
+			"main_plan9.go": `package main
+
+import _ "example.com/testmod/plan9"
+`,
+			"win/win.go": `package win
+`,
+			"darwin/darwin.go": `package darwin
+`,
+			"plan9/plan9.go": `package plan9
+`,
+		},
+		config: Config{Platforms: []Platform{
+			{GOOS: "linux", GOARCH: "amd64"},
+			{GOOS: "darwin", GOARCH: "arm64"},
+			{GOOS: "windows", GOARCH: "amd64"},
+		}},
+		expected: []string{
+			"go.mod",
+			"main.go",
+			"main_windows.go",
+			"main_darwin.go",
+			"main_plan9.go",
+			"win/win.go",
+			"darwin/darwin.go",
+		},
+	})
+}
+
+func TestFindCgo(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"go.mod": `module example.com/testmod
+
+go 1.18
+`,
+		"main.go": `package main
+
+func main() {}
+`,
+		"cgo.go": `package main
+
+// int answer(void);
+import "C"
+
+import _ "example.com/testmod/native"
+`,
+		"answer.c": `int answer(void) { return 42; }
+`,
+		"purego.go": `//go:build !cgo
+
+package main
+
+import _ "example.com/testmod/fallback"
+`,
+		"native/native.go": `package native
+`,
+		"fallback/fallback.go": `package fallback
+`,
+	}
+
+	enabled, disabled := true, false
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:  files,
+			config: Config{CgoEnabled: &enabled},
+			expected: []string{
+				"go.mod",
+				"main.go",
+				"cgo.go",
+				"answer.c",
+				"purego.go",
+				"native/native.go",
+			},
+		})
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:  files,
+			config: Config{CgoEnabled: &disabled},
+			expected: []string{
+				"go.mod",
+				"main.go",
+				"cgo.go",
+				"purego.go",
+				"fallback/fallback.go",
+			},
+		})
+	})
+}
+
+func TestFindGoVersion(t *testing.T) {
+	t.Parallel()
+
+	files := func(goLine string) map[string]string {
+		return map[string]string{
+			"go.mod": "module example.com/testmod\n\n" + goLine + "\n",
+			"main.go": `package main
+
+func main() {}
+`,
+			"future.go": `//go:build go1.99
+
+package main
+
+import _ "example.com/testmod/future"
+`,
+			"past.go": `//go:build !go1.21
+
+package main
+
+import _ "example.com/testmod/past"
+`,
+			"future/future.go": `package future
+`,
+			"past/past.go": `package past
+`,
+		}
+	}
+
+	t.Run("local-toolchain", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:    files("go 1.21"),
+			expected: []string{"go.mod", "main.go", "future.go", "past.go"},
+		})
+	})
+
+	t.Run("go-line", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files: files("go 1.99"),
+			expected: []string{
+				"go.mod", "main.go", "future.go", "past.go",
+				"future/future.go",
+			},
+		})
+	})
+
+	t.Run("toolchain-line", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files: files("go 1.21\n\ntoolchain go1.99.1"),
+			expected: []string{
+				"go.mod", "main.go", "future.go", "past.go",
+				"future/future.go",
+			},
+		})
+	})
+
+	t.Run("local-gotoolchain", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:    files("go 1.99"),
+			config:   Config{GOTOOLCHAIN: "local"},
+			expected: []string{"go.mod", "main.go", "future.go", "past.go"},
+		})
+	})
+
+	t.Run("local-auto-gotoolchain", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:  files("go 1.99"),
+			config: Config{GOTOOLCHAIN: "local+auto"},
+			expected: []string{
+				"go.mod", "main.go", "future.go", "past.go",
+				"future/future.go",
+			},
+		})
+	})
+
+	t.Run("override", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:  files("go 1.99"),
+			config: Config{GoVersion: "1.20"},
+			expected: []string{
+				"go.mod", "main.go", "future.go", "past.go",
+				"past/past.go",
+			},
+		})
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		tmpDir := t.TempDir()
+		for path, content := range files("go 1.21") {
+			fullPath := filepath.Join(tmpDir, path)
+			assert.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+			assert.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+		}
+		for _, config := range []Config{
+			{GoVersion: "1"},
+			{GoVersion: "2.0"},
+			{GoVersion: "1.x"},
+			{GOTOOLCHAIN: "go1"},
+			{GOTOOLCHAIN: "go2.0+auto"},
+		} {
+			_, err := Find(t.Context(), []string{tmpDir}, false, true, true, config)
+			assert.ErrorContains(t, err, "invalid go version", "%+v", config)
+		}
+	})
+}
+
+func TestFindVendor(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"app/go.mod": `module example.com/app
+
+go 1.18
+
+require example.com/dep v1.0.0
+
+replace example.com/dep => ../dep
+`,
+		"app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/dep"
+)
+
+func main() { fmt.Println(dep.Message()) }
+`,
+		"app/vendor/modules.txt": `# example.com/dep v1.0.0 => ../dep
+## explicit
+example.com/dep
+example.com/dep/sub
+`,
+		"app/vendor/example.com/dep/dep.go": `package dep
+
+import "example.com/dep/sub"
+
+func Message() string { return sub.Message() }
+`,
+		"app/vendor/example.com/dep/sub/sub.go": `package sub
+
+func Message() string { return "vendored" }
+`,
+		"dep/go.mod": `module example.com/dep
+
+go 1.18
+`,
+		"dep/dep.go": `package dep
+
+import "example.com/dep/sub"
+
+func Message() string { return sub.Message() }
+`,
+		"dep/sub/sub.go": `package sub
+
+func Message() string { return "replaced" }
+`,
+	}
+
+	t.Run("auto", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			runDir: "app",
+			files:  files,
+			expected: []string{
+				"app/go.mod",
+				"app/main.go",
+				"app/vendor/modules.txt",
+				"app/vendor/example.com/dep/dep.go",
+				"app/vendor/example.com/dep/sub/sub.go",
+			},
+		})
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		vendor := false
+		testFind(t, testFindArgs{
+			runDir: "app",
+			files:  files,
+			config: Config{Vendor: &vendor},
+			expected: []string{
+				"app/go.mod",
+				"app/main.go",
+				"dep/go.mod",
+				"dep/dep.go",
+				"dep/sub/sub.go",
+			},
+		})
+	})
+}
+
+func TestFindWorkspaceVendor(t *testing.T) {
+	t.Parallel()
+	testFind(t, testFindArgs{
+		runDir: "a",
+		files: map[string]string{
+			"go.work": `go 1.22
+
+use ./a
+use ./b
+`,
+			"a/go.mod": `module example.com/a
+
+go 1.22
+`,
+			"a/main.go": `package main
+
+import (
+	"example.com/b"
+	"example.com/dep"
+)
+
+func main() { b.B(); dep.Dep() }
+`,
+			"b/go.mod": `module example.com/b
+
+go 1.22
+`,
+			"b/b.go": `package b
+
+func B() {}
+`,
+			"vendor/modules.txt": `# example.com/dep v1.0.0
+## explicit; go 1.22
+example.com/dep
+`,
+			"vendor/example.com/dep/dep.go": `package dep
+
+func Dep() {}
+`,
+		},
+		expected: []string{
+			"go.work",
+			"a/go.mod",
+			"a/main.go",
+			"b/go.mod",
+			"b/b.go",
+			"vendor/modules.txt",
+			"vendor/example.com/dep/dep.go",
+		},
+	})
+}
+
+func TestFindExternal(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"app/go.mod": `module example.com/app
+
+go 1.21
+
+require (
+	example.com/Dep v1.2.0
+	example.com/other v0.1.0
+)
+
+replace example.com/other => example.com/fork v0.2.0
+`,
+		"app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/Dep"
+)
+
+func main() { fmt.Println(dep.Message()) }
+`,
+		"modcache/example.com/!dep@v1.2.0/go.mod": `module example.com/Dep
+
+go 1.21
+`,
+		"modcache/example.com/!dep@v1.2.0/dep.go": `package dep
+
+import (
+	"example.com/Dep/sub"
+	"example.com/other"
+)
+
+func Message() string { return sub.Message() + other.Message() }
+`,
+		"modcache/example.com/!dep@v1.2.0/sub/sub.go": `package sub
+
+func Message() string { return "sub" }
+`,
+		"modcache/example.com/!dep@v1.2.0/unused/unused.go": `package unused
+`,
+		"modcache/example.com/fork@v0.2.0/other.go": `package other
+
+func Message() string { return "fork" }
+`,
+		"modcache/example.com/other@v0.1.0/other.go": `package other
+
+func Message() string { return "original" }
+`,
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			runDir:   "app",
+			files:    files,
+			modCache: "modcache",
+			config:   Config{External: true},
+			expected: []string{
+				"app/go.mod",
+				"app/main.go",
+				"modcache/example.com/!dep@v1.2.0/go.mod",
+				"modcache/example.com/!dep@v1.2.0/dep.go",
+				"modcache/example.com/!dep@v1.2.0/sub/sub.go",
+				"modcache/example.com/fork@v0.2.0/other.go",
+			},
+		})
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			runDir:   "app",
+			files:    files,
+			modCache: "modcache",
+			expected: []string{
+				"app/go.mod",
+				"app/main.go",
+			},
+		})
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		t.Parallel()
+
+		tmpDir := t.TempDir()
+		for path, content := range map[string]string{
+			"go.mod": `module example.com/app
+
+go 1.21
+
+require example.com/missing v1.0.0
+`,
+			"main.go": `package main
+
+import _ "example.com/missing"
+`,
+		} {
+			assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, path), []byte(content), 0644))
+		}
+
+		ctx := log.New(t.Context(), slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: slog.LevelWarn,
+		})))
+		_, err := Find(ctx, []string{tmpDir}, false, true, true, Config{
+			External:   true,
+			GOMODCACHE: filepath.Join(tmpDir, "modcache"),
+		})
+		assert.ErrorContains(t, err, "module example.com/missing@v1.0.0 is not in the module cache")
+	})
+}
+
+func TestFindEmbedErrors(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"go.mod": `module example.com/app
+
+go 1.21
+`,
+		"main.go": `package main
+
+import _ "embed"
+
+//go:embed assets/*.json
+var config string
+
+//go:embed static.txt
+var static string
+
+func main() {}
+`,
+		"static.txt": "static",
+	}
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		tmpDir := t.TempDir()
+		for path, content := range files {
+			assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, path), []byte(content), 0644))
+		}
+
+		ctx := log.New(t.Context(), slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: slog.LevelWarn,
+		})))
+		_, err := Find(ctx, []string{tmpDir}, false, true, true, Config{})
+		var embedErr *EmbedError
+		if assert.ErrorAs(t, err, &embedErr) {
+			assert.Equal(t, "assets/*.json", embedErr.Pattern)
+		}
+		assert.ErrorIs(t, err, ErrNoMatchingFiles)
+	})
+
+	t.Run("warning", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:    files,
+			config:   Config{EmbedWarnings: true},
+			expected: []string{"go.mod", "main.go", "static.txt"},
+		})
+	})
+}
+
+func TestFindMultiplePackages(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"go.mod": `module example.com/m
+
+go 1.21
+`,
+		"cmd/server/main.go": `package main
+
+import "example.com/m/internal/shared"
+
+func main() { shared.Run() }
+`,
+		"cmd/client/main.go": `package main
+
+import "example.com/m/internal/client"
+
+func main() { client.Run() }
+`,
+		"internal/client/client.go": `package client
+
+import "example.com/m/internal/shared"
+
+func Run() { shared.Run() }
+`,
+		"internal/shared/shared.go": `package shared
+
+func Run() {}
+`,
+		"internal/unused/unused.go": `package unused
+`,
+		"other/go.mod": `module example.com/other
+
+go 1.21
+`,
+		"other/other.go": `package other
+`,
+	}
+
+	t.Run("union", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			files:   files,
+			runDirs: []string{"cmd/server", "cmd/client", "internal/client"},
+			expected: []string{
+				"go.mod",
+				"cmd/server/main.go",
+				"cmd/client/main.go",
+				"internal/client/client.go",
+				"internal/shared/shared.go",
+			},
+		})
+	})
+
+	t.Run("outside-main-module", func(t *testing.T) {
+		t.Parallel()
+
+		tmpDir := t.TempDir()
+		for path, content := range files {
+			fullPath := filepath.Join(tmpDir, path)
+			assert.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+			assert.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+		}
+
+		ctx := log.New(t.Context(), slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: slog.LevelWarn,
+		})))
+		_, err := Find(ctx, []string{filepath.Join(tmpDir, "cmd", "server"), filepath.Join(tmpDir, "other")},
+			false, true, true, Config{})
+		assert.ErrorContains(t, err, "is outside the main modules")
+	})
+}
+
+func TestFindCgoIncludes(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"go.mod": `module example.com/testmod
+
+go 1.21
+`,
+		"cmd/native/main.go": `package main
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/include
+#include <stdio.h>
+#include "../../third_party/foo/foo.h"
+#include "inc.h"
+*/
+import "C"
+
+func main() {}
+`,
+		"cmd/native/purego.go": `//go:build !cgo
+
+package main
+
+func main() {}
+`,
+		"cmd/native/impl.c": `#include "local.h"
+`,
+		"cmd/native/local.h": `#define LOCAL 1
+`,
+		"cmd/native/include/inc.h": `#define INC 1
+`,
+		"third_party/foo/foo.h": `#include "bar.h"
+#include "../common/common.h"
+`,
+		"third_party/foo/bar.h": `#include "foo.h" // cycles must not loop forever
+`,
+		"third_party/common/common.h": `#define COMMON 1
+`,
+		"third_party/unused/unused.h": `#define UNUSED 1
+`,
+	}
+
+	enabled, disabled := true, false
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			runDir: "cmd/native",
+			files:  files,
+			config: Config{CgoEnabled: &enabled},
+			expected: []string{
+				"go.mod",
+				"cmd/native/main.go",
+				"cmd/native/purego.go",
+				"cmd/native/impl.c",
+				"cmd/native/local.h",
+				"cmd/native/include/inc.h",
+				"third_party/foo/foo.h",
+				"third_party/foo/bar.h",
+				"third_party/common/common.h",
+			},
+		})
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		testFind(t, testFindArgs{
+			runDir: "cmd/native",
+			files:  files,
+			config: Config{CgoEnabled: &disabled},
+			expected: []string{
+				"go.mod",
+				"cmd/native/main.go",
+				"cmd/native/purego.go",
+				"cmd/native/local.h",
+			},
+		})
+	})
+}
+
+func TestKnownPlatforms(t *testing.T) {
+	t.Parallel()
+
+	platforms := KnownPlatforms()
+	assert.Contains(t, platforms, Platform{GOOS: "linux", GOARCH: "amd64"})
+	assert.Contains(t, platforms, Platform{GOOS: "windows", GOARCH: "arm64"})
+}
+
+func TestArchTags(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"amd64.v1", "amd64.v2", "amd64.v3"}, archTags("amd64", "", "v3"))
+	assert.Equal(t, []string{"arm.5", "arm.6"}, archTags("arm", "6,softfloat", ""))
+	assert.Equal(t, []string{"arm.5", "arm.6", "arm.7"}, archTags("arm", "", ""))
+	assert.Empty(t, archTags("loong64", "", ""))
+}
+
 func TestFindPartialDependency(t *testing.T) {
 	t.Parallel()
 	testFind(t, testFindArgs{
@@ -826,3 +1655,32 @@ func TestModuleCovers(t *testing.T) {
 		})
 	}
 }
+
+func TestMainModules(t *testing.T) {
+	// Not parallel: the test changes the working directory.
+	tmpDir := t.TempDir()
+	for path, content := range map[string]string{
+		"go.work":           "go 1.24\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod":          "module example.com/a\n\ngo 1.24\n",
+		"a/cmd/srv/main.go": "package main\n",
+		"b/go.mod":          "module example.com/b\n\ngo 1.24\n",
+	} {
+		fullPath := filepath.Join(tmpDir, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		assert.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	// A relative directory is searched from the working directory, which can be below
+	// the module root.
+	t.Chdir(filepath.Join(tmpDir, "a", "cmd", "srv"))
+
+	dirs, err := MainModules(t.Context(), ".", false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{filepath.Join(tmpDir, "a")}, dirs)
+	}
+
+	dirs, err = MainModules(t.Context(), ".", true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")}, dirs)
+	}
+}
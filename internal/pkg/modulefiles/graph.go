@@ -0,0 +1,358 @@
+package modulefiles
+
+import (
+	"context"
+	"maps"
+	"path/filepath"
+	"slices"
+)
+
+// Graph is the graph of packages reached from a set of root packages, and the files that
+// each of them depends on.
+type Graph struct {
+	// Roots holds the import paths of the root packages.
+	Roots []string
+	// Packages holds each package reached from Roots, by import path.
+	Packages map[string]*GraphPackage
+	// Modules holds each module that was consulted, by root directory.
+	Modules map[string]*GraphModule
+	// Files holds the files that configure the build as a whole, such as go.work and
+	// vendor/modules.txt.
+	Files []string
+	// Config is the configuration that the graph was found under, with GoVersion and
+	// Vendor resolved. Unless Platforms is set, GOOS, GOARCH and CgoEnabled are resolved
+	// too.
+	Config Config
+	// RequiredGoVersion is the go version that the build asks for: Config.GoVersion as
+	// given, the version set by GOTOOLCHAIN, or else the version required by go.work (or
+	// go.mod). Unlike the resolved Config.GoVersion, it doesn't depend on the version of
+	// the local toolchain.
+	RequiredGoVersion string
+	// MainModule is the root directory of the main module, which is the module of the
+	// first root.
+	MainModule string
+}
+
+// GraphPackage is a package in a [Graph].
+type GraphPackage struct {
+	ImportPath string
+	Dir        string
+	// Module is the root directory of the module that provides the package, or "" if
+	// the package is vendored.
+	Module string
+	// Via describes how the import path of the package was resolved into Dir. It is
+	// decided by the module that provides the package, so it doesn't depend on which
+	// import reached the package first.
+	Via Resolution
+	// Files holds the files that the package depends on.
+	Files []GraphFile
+	// Imports holds the imports of the package that are part of the graph.
+	Imports []GraphImport
+
+	fileIndex map[string]int // An index into Files by path
+}
+
+// GraphFile is a file that a [GraphPackage] depends on.
+type GraphFile struct {
+	// Path is the absolute path of the file.
+	Path string
+	// Embed is the go:embed pattern that matched the file, if any.
+	Embed string `json:",omitempty"`
+	// Test reports if the file is only depended on by the tests of the package.
+	Test bool `json:",omitempty"`
+}
+
+// GraphImport is an import edge in a [Graph].
+type GraphImport struct {
+	ImportPath string
+	// Test reports if the import is only made by the tests of the package.
+	Test bool `json:",omitempty"`
+}
+
+// GraphModule is a module in a [Graph].
+type GraphModule struct {
+	// Path is the module path, as declared in go.mod.
+	Path string
+	Dir  string
+	// Files holds go.mod and go.sum, when module files are requested.
+	Files []string
+}
+
+// Resolution describes how an import path was resolved into a directory.
+type Resolution string
+
+const (
+	// ResolvedRoot is a root package, named directly.
+	ResolvedRoot Resolution = "root"
+	// ResolvedModule is a package in the same module as the package that imports it.
+	ResolvedModule Resolution = "module"
+	// ResolvedReplace is a package in a module replaced by a local replace directive.
+	ResolvedReplace Resolution = "replace"
+	// ResolvedWorkspace is a package in a module used by go.work.
+	ResolvedWorkspace Resolution = "workspace"
+	// ResolvedVendor is a package in the vendor directory.
+	ResolvedVendor Resolution = "vendor"
+	// ResolvedExternal is a package in the module cache.
+	ResolvedExternal Resolution = "external"
+)
+
+// FindGraph finds the graph of packages reached from the packages at roots when built
+// under config, and the files that each of them depends on.
+//
+// The files of the graph are exactly the files reported by [Find], which also reports the
+// directories of the graph (see [Graph.Dirs]) when config.Dirs is set.
+func FindGraph(ctx context.Context, roots []string, testPaths, modFiles, goWork bool, config Config) (*Graph, error) {
+	return findGraph(ctx, roots, testPaths, modFiles, goWork, config, new(modules),
+		func(c Config) importer { return c.buildContext() })
+}
+
+// AllFiles returns every file in g, sorted.
+func (g *Graph) AllFiles() []string {
+	files := map[string]struct{}{}
+	for _, pkg := range g.Packages {
+		for _, f := range pkg.Files {
+			files[f.Path] = struct{}{}
+		}
+	}
+	for _, mod := range g.Modules {
+		for _, f := range mod.Files {
+			files[f] = struct{}{}
+		}
+	}
+	for _, f := range g.Files {
+		files[f] = struct{}{}
+	}
+	return slices.Sorted(maps.Keys(files))
+}
+
+// Dirs returns the directories whose entries decide the files of g, sorted: the directory
+// of each package, and each directory that holds an embedded file (up to the directory of
+// the package that embeds it).
+//
+// A directory's modification time changes when an entry is added to or removed from it,
+// so depending on Dirs notices new files that would join a package or match a go:embed
+// pattern.
+func (g *Graph) Dirs() []string {
+	dirs := map[string]struct{}{}
+	for _, pkg := range g.Packages {
+		dirs[pkg.Dir] = struct{}{}
+		for _, f := range pkg.Files {
+			if f.Embed == "" {
+				continue
+			}
+			for dir := filepath.Dir(f.Path); dir != pkg.Dir && isWithin(pkg.Dir, dir); dir = filepath.Dir(dir) {
+				dirs[dir] = struct{}{}
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(dirs))
+}
+
+// findResult returns the paths that [Find] reports for g under config.
+func (g *Graph) findResult(config Config) []string {
+	files := g.AllFiles()
+	if config.Dirs {
+		files = append(files, g.Dirs()...)
+		slices.Sort(files)
+		files = slices.Compact(files)
+	}
+	return files
+}
+
+func newGraph() *Graph {
+	return &Graph{
+		Packages: map[string]*GraphPackage{},
+		Modules:  map[string]*GraphModule{},
+	}
+}
+
+// addPackage adds the package found by a walk to g, merging it with the package of the
+// same import path found by a previous walk (for a different platform).
+func (g *Graph) addPackage(found foundPackage) *GraphPackage {
+	if pkg, ok := g.Packages[found.importPath]; ok {
+		return pkg
+	}
+	pkg := &GraphPackage{
+		ImportPath: found.importPath,
+		Dir:        found.Dir,
+		Module:     found.module,
+		Via:        found.via,
+		fileIndex:  map[string]int{},
+	}
+	g.Packages[found.importPath] = pkg
+	if found.via == ResolvedRoot {
+		g.Roots = append(g.Roots, found.importPath)
+		slices.Sort(g.Roots)
+	}
+	return pkg
+}
+
+// addFile adds f to the files of pkg. A file that is depended on by both a package and
+// its tests is not a test file.
+func (pkg *GraphPackage) addFile(f GraphFile) {
+	i, ok := pkg.fileIndex[f.Path]
+	if !ok {
+		pkg.fileIndex[f.Path] = len(pkg.Files)
+		pkg.Files = append(pkg.Files, f)
+		return
+	}
+	if !f.Test {
+		pkg.Files[i].Test = false
+	}
+}
+
+// addImports adds the imports of found to pkg that are part of g.
+func (g *Graph) addImports(pkg *GraphPackage, found foundPackage, includeTests bool) {
+	add := func(imports []string, test bool) {
+		for _, importPath := range imports {
+			if _, ok := g.Packages[importPath]; !ok || importPath == pkg.ImportPath {
+				continue
+			}
+			i := slices.IndexFunc(pkg.Imports, func(imp GraphImport) bool { return imp.ImportPath == importPath })
+			switch {
+			case i < 0:
+				pkg.Imports = append(pkg.Imports, GraphImport{ImportPath: importPath, Test: test})
+			case !test:
+				pkg.Imports[i].Test = false
+			}
+		}
+	}
+	add(found.Imports, false)
+	if includeTests {
+		add(found.TestImports, true)
+		add(found.XTestImports, true)
+	}
+}
+
+// Explanation explains why a file is part of a [Graph].
+type Explanation struct {
+	// Chain is the shortest chain of imports from a root to a package that depends on
+	// the file. Chain[0] is the root.
+	Chain []ExplanationStep
+	// File describes how the last package of Chain depends on the file, unless the file
+	// belongs to Module.
+	File *GraphFile
+	// Module is the module of the last package of Chain, when the file is one of its
+	// files (such as go.mod).
+	Module *GraphModule
+}
+
+// ExplanationStep is a package in an [Explanation].
+type ExplanationStep struct {
+	Package *GraphPackage
+	// TestImport reports whether the package is only imported by the tests of the
+	// previous package.
+	TestImport bool
+}
+
+// Why explains why file (an absolute path) is part of g, with the shortest chain of
+// imports that leads from a root to a package that depends on file.
+//
+// Why returns false if no package depends on file. Files that configure the build as a
+// whole (see [Graph.Files]) are not depended on by any particular package.
+func (g *Graph) Why(file string) (Explanation, bool) {
+	match := func(pkg *GraphPackage) (Explanation, bool) {
+		for i, f := range pkg.Files {
+			if f.Path == file {
+				return Explanation{File: &pkg.Files[i]}, true
+			}
+		}
+		if mod, ok := g.Modules[pkg.Module]; ok && slices.Contains(mod.Files, file) {
+			return Explanation{Module: mod}, true
+		}
+		return Explanation{}, false
+	}
+
+	// A breadth first search finds the shortest chain.
+	type node struct {
+		step   ExplanationStep
+		parent *node
+	}
+	var queue []*node
+	seen := map[string]struct{}{}
+	for _, root := range g.Roots {
+		queue = append(queue, &node{step: ExplanationStep{Package: g.Packages[root]}})
+		seen[root] = struct{}{}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if e, ok := match(n.step.Package); ok {
+			for ; n != nil; n = n.parent {
+				e.Chain = append(e.Chain, n.step)
+			}
+			slices.Reverse(e.Chain)
+			return e, true
+		}
+		for _, imp := range n.step.Package.Imports {
+			if _, ok := seen[imp.ImportPath]; ok {
+				continue
+			}
+			seen[imp.ImportPath] = struct{}{}
+			queue = append(queue, &node{
+				step:   ExplanationStep{Package: g.Packages[imp.ImportPath], TestImport: imp.Test},
+				parent: n,
+			})
+		}
+	}
+	return Explanation{}, false
+}
+
+// Affected returns the roots of g that depend on any of changed (absolute paths), sorted.
+//
+// A root depends on the files of each package it reaches, and on the module files (such
+// as go.mod) of their modules. Every root depends on the files that configure the build as
+// a whole (see [Graph.Files]). When tests is set, the test files and test imports of each
+// root are dependencies too, but not those of the packages it reaches.
+//
+// A changed path that names the directory of a package affects the package. This accounts
+// for files deleted from the directory, which are no longer part of g.
+func (g *Graph) Affected(changed []string, tests bool) []string {
+	changedSet := make(map[string]struct{}, len(changed))
+	for _, f := range changed {
+		changedSet[f] = struct{}{}
+	}
+	isChanged := func(f string) bool {
+		_, ok := changedSet[f]
+		return ok
+	}
+
+	if slices.ContainsFunc(g.Files, isChanged) {
+		return slices.Clone(g.Roots)
+	}
+
+	var affected []string
+	for _, root := range g.Roots {
+		seen := map[string]struct{}{}
+		var visit func(importPath string, isRoot bool) bool
+		visit = func(importPath string, isRoot bool) bool {
+			if _, ok := seen[importPath]; ok {
+				return false
+			}
+			seen[importPath] = struct{}{}
+			pkg := g.Packages[importPath]
+			withTests := isRoot && tests
+			if isChanged(pkg.Dir) {
+				return true
+			}
+			for _, f := range pkg.Files {
+				if (!f.Test || withTests) && isChanged(f.Path) {
+					return true
+				}
+			}
+			if mod, ok := g.Modules[pkg.Module]; ok && slices.ContainsFunc(mod.Files, isChanged) {
+				return true
+			}
+			for _, imp := range pkg.Imports {
+				if (!imp.Test || withTests) && visit(imp.ImportPath, false) {
+					return true
+				}
+			}
+			return false
+		}
+		if visit(root, true) {
+			affected = append(affected, root)
+		}
+	}
+	return affected
+}
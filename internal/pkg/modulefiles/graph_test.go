@@ -0,0 +1,380 @@
+package modulefiles
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+)
+
+func TestGraphWhy(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	for path, content := range map[string]string{
+		"go.work": `go 1.21
+
+use (
+	./app
+	./shared
+)
+`,
+		"app/go.mod": `module example.com/app
+
+go 1.21
+
+require example.com/lib v0.0.0
+
+replace example.com/lib => ../lib
+`,
+		"app/main.go": `package main
+
+import (
+	"example.com/app/internal/web"
+	"example.com/lib"
+)
+
+func main() { web.Serve(); lib.Run() }
+`,
+		"app/internal/web/web.go": `package web
+
+import (
+	"embed"
+
+	"example.com/shared"
+)
+
+//go:embed static
+var static embed.FS
+
+func Serve() { shared.Run() }
+`,
+		"app/internal/web/static/app.js": "app",
+		"app/main_test.go": `package main
+
+import (
+	"testing"
+
+	"example.com/app/internal/testutil"
+)
+
+func TestMain(t *testing.T) { testutil.Run() }
+`,
+		"app/internal/testutil/testutil.go": `package testutil
+
+func Run() {}
+`,
+		"lib/go.mod": `module example.com/lib
+
+go 1.21
+`,
+		"lib/lib.go": `package lib
+
+func Run() {}
+`,
+		"shared/go.mod": `module example.com/shared
+
+go 1.21
+`,
+		"shared/shared.go": `package shared
+
+func Run() {}
+`,
+	} {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	ctx := log.New(t.Context(), slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	})))
+	graph, err := FindGraph(ctx, []string{filepath.Join(tmpDir, "app")}, true, true, true, Config{})
+	require.NoError(t, err)
+
+	type step struct {
+		importPath string
+		via        Resolution
+		testImport bool
+	}
+	why := func(file string) ([]step, Explanation) {
+		e, ok := graph.Why(filepath.Join(tmpDir, file))
+		require.True(t, ok, "expected %s to be explained", file)
+		steps := make([]step, len(e.Chain))
+		for i, s := range e.Chain {
+			steps[i] = step{s.Package.ImportPath, s.Package.Via, s.TestImport}
+		}
+		return steps, e
+	}
+
+	steps, e := why("app/internal/web/static/app.js")
+	assert.Equal(t, []step{
+		{"example.com/app", ResolvedRoot, false},
+		{"example.com/app/internal/web", ResolvedModule, false},
+	}, steps)
+	assert.Equal(t, "static", e.File.Embed)
+
+	steps, _ = why("lib/lib.go")
+	assert.Equal(t, []step{
+		{"example.com/app", ResolvedRoot, false},
+		{"example.com/lib", ResolvedReplace, false},
+	}, steps)
+
+	steps, e = why("shared/go.mod")
+	assert.Equal(t, []step{
+		{"example.com/app", ResolvedRoot, false},
+		{"example.com/app/internal/web", ResolvedModule, false},
+		{"example.com/shared", ResolvedWorkspace, false},
+	}, steps)
+	assert.Equal(t, "example.com/shared", e.Module.Path)
+
+	steps, _ = why("app/internal/testutil/testutil.go")
+	assert.Equal(t, []step{
+		{"example.com/app", ResolvedRoot, false},
+		{"example.com/app/internal/testutil", ResolvedModule, true},
+	}, steps)
+
+	steps, e = why("app/main_test.go")
+	assert.Equal(t, []step{{"example.com/app", ResolvedRoot, false}}, steps)
+	assert.True(t, e.File.Test)
+
+	assert.Contains(t, graph.Files, filepath.Join(tmpDir, "go.work"))
+	_, ok := graph.Why(filepath.Join(tmpDir, "go.work"))
+	assert.False(t, ok)
+}
+
+func TestGraphVia(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	for path, content := range map[string]string{
+		"app/go.mod": `module example.com/app
+
+go 1.21
+
+require other.example v0.0.0
+
+replace other.example => ../other
+`,
+		"app/main.go": `package main
+
+import (
+	"example.com/app/c"
+	"other.example/a"
+)
+
+func main() { a.Run(); c.Run() }
+`,
+		"app/c/c.go": `package c
+
+import "other.example/b"
+
+func Run() { b.Run() }
+`,
+		"other/go.mod": `module other.example
+
+go 1.21
+`,
+		"other/a/a.go": `package a
+
+import "other.example/b"
+
+func Run() { b.Run() }
+`,
+		"other/b/b.go": `package b
+
+func Run() {}
+`,
+	} {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	// other.example/b is reached both through the replace and from its own module, so
+	// walks that reach it in either order must agree on how it was resolved.
+	for range 20 {
+		graph, err := FindGraph(t.Context(), []string{filepath.Join(tmpDir, "app")}, false, true, true, Config{})
+		require.NoError(t, err)
+		via := map[string]Resolution{}
+		for importPath, pkg := range graph.Packages {
+			via[importPath] = pkg.Via
+		}
+		require.Equal(t, map[string]Resolution{
+			"example.com/app":   ResolvedRoot,
+			"example.com/app/c": ResolvedModule,
+			"other.example/a":   ResolvedReplace,
+			"other.example/b":   ResolvedReplace,
+		}, via)
+	}
+}
+
+func TestGraphGoVersion(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	for path, content := range map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.21\n",
+		"cmd/app/main.go": `package main
+
+func main() {}
+`,
+	} {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	graph, err := FindGraph(t.Context(), []string{filepath.Join(tmpDir, "cmd", "app")}, false, true, false, Config{})
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir, graph.MainModule)
+	// The local toolchain is newer than go.mod asks for, so it builds the package, but
+	// only the version that go.mod asks for is required.
+	assert.Equal(t, localGoVersion, graph.Config.GoVersion)
+	assert.Equal(t, "go1.21", graph.RequiredGoVersion)
+
+	graph, err = FindGraph(t.Context(), []string{filepath.Join(tmpDir, "cmd", "app")}, false, true, false, Config{GOTOOLCHAIN: "go1.22.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "go1.22.1", graph.Config.GoVersion)
+	assert.Equal(t, "go1.22.1", graph.RequiredGoVersion)
+}
+
+func TestGraphAffected(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	for path, content := range map[string]string{
+		"go.mod": `module example.com/m
+
+go 1.21
+`,
+		"cmd/a/main.go": `package main
+
+import "example.com/m/lib"
+
+func main() { lib.Run() }
+`,
+		"cmd/b/main.go": `package main
+
+func main() {}
+`,
+		"cmd/b/main_test.go": `package main
+
+import (
+	"testing"
+
+	"example.com/m/testutil"
+)
+
+func TestMain(t *testing.T) { testutil.Run() }
+`,
+		"lib/lib.go": `package lib
+
+import _ "embed"
+
+//go:embed data.txt
+var data string
+
+func Run() {}
+`,
+		"lib/lib_test.go": `package lib
+`,
+		"lib/data.txt": "data",
+		"testutil/testutil.go": `package testutil
+
+func Run() {}
+`,
+	} {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	ctx := log.New(t.Context(), slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	})))
+	roots := []string{filepath.Join(tmpDir, "cmd", "a"), filepath.Join(tmpDir, "cmd", "b")}
+
+	affected := func(tests bool, changed ...string) []string {
+		graph, err := FindGraph(ctx, roots, tests, true, true, Config{})
+		require.NoError(t, err)
+		for i, f := range changed {
+			changed[i] = filepath.Join(tmpDir, f)
+		}
+		return graph.Affected(changed, tests)
+	}
+
+	assert.Equal(t, []string{"example.com/m/cmd/a"}, affected(false, "lib/data.txt"))
+	assert.Equal(t, []string{"example.com/m/cmd/a", "example.com/m/cmd/b"}, affected(false, "go.mod"))
+	assert.Empty(t, affected(false, "testutil/testutil.go"))
+	assert.Empty(t, affected(false, "README.md"))
+	// A file was deleted from lib.
+	assert.Equal(t, []string{"example.com/m/cmd/a"}, affected(false, "lib"))
+
+	assert.Equal(t, []string{"example.com/m/cmd/b"}, affected(true, "testutil/testutil.go"))
+	assert.Equal(t, []string{"example.com/m/cmd/b"}, affected(true, "cmd/b/main_test.go"))
+	// The tests of dependencies are not inputs of the tests of roots.
+	assert.Empty(t, affected(true, "lib/lib_test.go"))
+}
+
+func TestGraphDirs(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	for path, content := range map[string]string{
+		"go.mod": `module example.com/m
+
+go 1.21
+`,
+		"main.go": `package main
+
+import "example.com/m/web"
+
+func main() { web.Serve() }
+`,
+		"web/web.go": `package web
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+func Serve() {}
+`,
+		"web/static/css/app.css":      "",
+		"web/static/js/vendor/lib.js": "",
+		"web/templates/index.tmpl":    "",
+	} {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	ctx := log.New(t.Context(), slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	})))
+	graph, err := FindGraph(ctx, []string{tmpDir}, false, true, true, Config{})
+	require.NoError(t, err)
+
+	var expected []string
+	for _, dir := range []string{
+		"", "web", "web/static", "web/static/css", "web/static/js", "web/static/js/vendor", "web/templates",
+	} {
+		expected = append(expected, filepath.Join(tmpDir, dir))
+	}
+	assert.Equal(t, expected, graph.Dirs())
+
+	files, err := Find(ctx, []string{tmpDir}, false, true, true, Config{Dirs: true})
+	require.NoError(t, err)
+	assert.Subset(t, files, expected)
+	assert.Subset(t, files, graph.AllFiles())
+	assert.Len(t, files, len(expected)+len(graph.AllFiles()))
+}
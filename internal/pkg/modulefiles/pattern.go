@@ -0,0 +1,231 @@
+package modulefiles
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+)
+
+// Package is a package matched by a pattern.
+type Package struct {
+	// Dir is the absolute path of the directory holding the package.
+	Dir string
+	// Name is the package name, such as "main", or "" for a package with only test
+	// files.
+	Name string
+}
+
+// IsCommand reports whether p builds a binary.
+func (p Package) IsCommand() bool { return p.Name == "main" }
+
+// MatchPackages resolves directory patterns into the packages they match, in the format
+// of `go list` (see `go help packages`): "..." matches any string, including the empty
+// string and strings containing slashes.
+//
+// Like the go command, wildcards don't match directories that begin with "." or "_",
+// testdata and vendor directories, or directories that belong to a different module.
+// Patterns without a wildcard always name a single package.
+//
+// A directory matches if it contains a package for any of config's platforms.
+func MatchPackages(ctx context.Context, patterns []string, config Config) ([]Package, error) {
+	if config.GoVersion != "" {
+		v, err := normalizeGoVersion(config.GoVersion)
+		if err != nil {
+			return nil, err
+		}
+		config.GoVersion = v
+	}
+
+	packages := map[string]Package{}
+	var errs []error
+	for _, pattern := range patterns {
+		dirs, err := matchDirs(ctx, pattern)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, dir := range dirs {
+			if _, ok := packages[dir]; ok {
+				continue
+			}
+			name, err := packageName(dir, config)
+			var noGo *build.NoGoError
+			switch {
+			case err == nil:
+				packages[dir] = Package{Dir: dir, Name: name}
+			case errors.As(err, &noGo) && strings.Contains(pattern, "..."):
+				// A wildcard only matches directories that hold a package.
+			default:
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	result := make([]Package, 0, len(packages))
+	for _, pkg := range packages {
+		result = append(result, pkg)
+	}
+	slices.SortFunc(result, func(a, b Package) int { return strings.Compare(a.Dir, b.Dir) })
+	if len(result) == 0 && len(errs) == 0 {
+		return nil, fmt.Errorf("no packages match %s", strings.Join(patterns, " "))
+	}
+	return result, errors.Join(errs...)
+}
+
+// packageName returns the name of the package in dir for the first of config's platforms
+// that it builds on. Like [build.Context.ImportDir], it fails with a [*build.NoGoError] if
+// dir holds no Go files that build.
+//
+// The package is imported again when its graph is found, so only the header of a single
+// non-test Go file that builds is read, instead of importing the whole package.
+func packageName(dir string, config Config) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	// The header of a file includes its leading comment, which can be long (such as the
+	// documentation of a command), so the smallest files are read first.
+	type goFile struct {
+		name string
+		size int64
+	}
+	var files []goFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, goFile{entry.Name(), info.Size()})
+	}
+	slices.SortStableFunc(files, func(a, b goFile) int { return cmp.Compare(a.size, b.size) })
+
+	var hasTests bool
+	for _, config := range config.platforms() {
+		ctxt := config.buildContext()
+		for _, f := range files {
+			if match, err := ctxt.MatchFile(dir, f.name); err != nil || !match {
+				continue
+			}
+			if strings.HasSuffix(f.name, "_test.go") {
+				hasTests = true
+				continue
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, f.name), nil, parser.ImportsOnly)
+			if err != nil {
+				return "", err
+			}
+			// Like the go command, files that use cgo are ignored when it is disabled.
+			if !ctxt.CgoEnabled && slices.ContainsFunc(file.Imports, func(i *ast.ImportSpec) bool {
+				return i.Path.Value == `"C"`
+			}) {
+				continue
+			}
+			return file.Name.Name, nil
+		}
+	}
+	if hasTests {
+		return "", nil
+	}
+	return "", &build.NoGoError{Dir: dir}
+}
+
+// matchDirs returns the absolute paths of the directories that pattern matches.
+func matchDirs(ctx context.Context, pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+	i := strings.Index(pattern, "...")
+	if i < 0 {
+		dir, err := filepath.Abs(filepath.FromSlash(pattern))
+		if err != nil {
+			return nil, err
+		}
+		return []string{dir}, nil
+	}
+
+	// Walk from the deepest directory that holds every match.
+	root := pattern[:i]
+	if j := strings.LastIndex(root, "/"); j >= 0 {
+		root = root[:j+1]
+	} else {
+		root = "."
+	}
+	root, err := filepath.Abs(filepath.FromSlash(root))
+	if err != nil {
+		return nil, err
+	}
+	absPattern, err := filepath.Abs(filepath.FromSlash(pattern))
+	if err != nil {
+		return nil, err
+	}
+	match := matchPattern(filepath.ToSlash(absPattern))
+
+	// WalkDir doesn't follow a symlinked root (such as a symlinked working directory), so
+	// walk its target and report the matches below root.
+	walkRoot := root
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		walkRoot = resolved
+	}
+
+	var dirs []string
+	err = filepath.WalkDir(walkRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == walkRoot {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(walkRoot, path)
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(root, rel)
+		if path != root {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+				name == "testdata" || name == "vendor" {
+				return filepath.SkipDir
+			}
+			// Nested modules are not part of the module being matched.
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				log.Debug(ctx, "Skipping nested module", log.Attr("dir", path))
+				return filepath.SkipDir
+			}
+		}
+		if match(filepath.ToSlash(path)) {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// matchPattern returns a function that reports whether a slash separated path matches
+// pattern, as the go command does.
+func matchPattern(pattern string) func(string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+	// "foo/..." also matches "foo".
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	reg := regexp.MustCompile(`^` + re + `$`)
+	return reg.MatchString
+}
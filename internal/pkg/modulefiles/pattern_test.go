@@ -0,0 +1,143 @@
+package modulefiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern, path string
+		expected      bool
+	}{
+		{"/m/cmd/...", "/m/cmd", true},
+		{"/m/cmd/...", "/m/cmd/server", true},
+		{"/m/cmd/...", "/m/cmd/server/internal", true},
+		{"/m/cmd/...", "/m/cmdline", false},
+		{"/m/cmd...", "/m/cmdline", true},
+		{"/m/.../internal", "/m/a/b/internal", true},
+		{"/m/.../internal", "/m/a/b/internal/c", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, matchPattern(tt.pattern)(tt.path), "%s matching %s", tt.pattern, tt.path)
+	}
+}
+
+func TestMatchPackages(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	for path, content := range map[string]string{
+		"go.mod":                      "module example.com/m\n\ngo 1.21\n",
+		"lib.go":                      "package m\n",
+		"cmd/server/main.go":          "package main\n",
+		"cmd/client/main.go":          "package main\n",
+		"cmd/client/testdata/main.go": "package main\n",
+		"cmd/_skipped/main.go":        "package main\n",
+		"cmd/.hidden/main.go":         "package main\n",
+		"cmd/nogo/README.md":          "not a package\n",
+		"cmd/windows/main_windows.go": "package main\n",
+		"vendor/example.com/v/v.go":   "package v\n",
+		"nested/go.mod":               "module example.com/nested\n\ngo 1.21\n",
+		"nested/main.go":              "package main\n",
+		"internal/util/util.go":       "package util\n",
+		"internal/util/util_test.go":  "package util\n",
+		"internal/tests/x_test.go":    "package tests_test\n",
+	} {
+		fullPath := filepath.Join(tmpDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+
+	match := func(config Config, patterns ...string) []Package {
+		for i, p := range patterns {
+			patterns[i] = filepath.Join(tmpDir, p)
+		}
+		pkgs, err := MatchPackages(t.Context(), patterns, config)
+		require.NoError(t, err)
+		for i := range pkgs {
+			pkgs[i].Dir, err = filepath.Rel(tmpDir, pkgs[i].Dir)
+			require.NoError(t, err)
+		}
+		return pkgs
+	}
+
+	linux := Config{GOOS: "linux", GOARCH: "amd64"}
+	assert.Equal(t, []Package{
+		{Dir: ".", Name: "m"},
+		{Dir: "cmd/client", Name: "main"},
+		{Dir: "cmd/server", Name: "main"},
+		{Dir: "internal/tests", Name: ""},
+		{Dir: "internal/util", Name: "util"},
+	}, match(linux, "..."))
+
+	assert.Equal(t, []Package{
+		{Dir: "cmd/client", Name: "main"},
+		{Dir: "cmd/server", Name: "main"},
+	}, match(linux, "cmd/...", "cmd/server"))
+
+	assert.Equal(t, []Package{
+		{Dir: "cmd/client", Name: "main"},
+		{Dir: "cmd/server", Name: "main"},
+		{Dir: "cmd/windows", Name: "main"},
+	}, match(Config{Platforms: []Platform{{"linux", "amd64"}, {"windows", "amd64"}}}, "cmd/..."))
+
+	t.Run("symlinked-root", func(t *testing.T) {
+		t.Parallel()
+
+		link := filepath.Join(t.TempDir(), "link")
+		require.NoError(t, os.Symlink(tmpDir, link))
+		pkgs, err := MatchPackages(t.Context(), []string{filepath.Join(link, "...")}, linux)
+		require.NoError(t, err)
+		assert.Equal(t, []Package{
+			{Dir: link, Name: "m"},
+			{Dir: filepath.Join(link, "cmd", "client"), Name: "main"},
+			{Dir: filepath.Join(link, "cmd", "server"), Name: "main"},
+			{Dir: filepath.Join(link, "internal", "tests"), Name: ""},
+			{Dir: filepath.Join(link, "internal", "util"), Name: "util"},
+		}, pkgs)
+	})
+
+	t.Run("go-version", func(t *testing.T) {
+		t.Parallel()
+
+		pkgs, err := MatchPackages(t.Context(), []string{filepath.Join(tmpDir, "cmd", "server")}, Config{GoVersion: "1.22"})
+		require.NoError(t, err)
+		assert.Equal(t, []Package{{Dir: filepath.Join(tmpDir, "cmd", "server"), Name: "main"}}, pkgs)
+
+		_, err = MatchPackages(t.Context(), []string{filepath.Join(tmpDir, "...")}, Config{GoVersion: "1"})
+		assert.ErrorContains(t, err, "invalid go version")
+	})
+
+	t.Run("cgo", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "cgo.go"), []byte("package main\n\nimport \"C\"\n"), 0644))
+		for _, enabled := range []bool{true, false} {
+			pkgs, err := MatchPackages(t.Context(), []string{filepath.Join(dir, "...")}, Config{CgoEnabled: &enabled})
+			if enabled {
+				require.NoError(t, err)
+				assert.Equal(t, []Package{{Dir: dir, Name: "main"}}, pkgs)
+			} else {
+				assert.ErrorContains(t, err, "no packages match")
+			}
+		}
+	})
+
+	t.Run("no-go-files", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := MatchPackages(t.Context(), []string{filepath.Join(tmpDir, "cmd", "nogo")}, linux)
+		assert.ErrorContains(t, err, "no buildable Go source files")
+
+		_, err = MatchPackages(t.Context(), []string{filepath.Join(tmpDir, "cmd", "nogo", "...")}, linux)
+		assert.ErrorContains(t, err, "no packages match")
+	})
+}
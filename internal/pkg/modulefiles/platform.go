@@ -0,0 +1,43 @@
+package modulefiles
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Platform is a GOOS/GOARCH pair that packages can be built for.
+type Platform struct {
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+}
+
+func (p Platform) String() string { return p.GOOS + "/" + p.GOARCH }
+
+// ParsePlatform parses a platform in the GOOS/GOARCH format used by `go tool dist list`.
+func ParsePlatform(s string) (Platform, error) {
+	goos, goarch, ok := strings.Cut(s, "/")
+	if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+		return Platform{}, fmt.Errorf("invalid platform %q: expected GOOS/GOARCH", s)
+	}
+	return Platform{GOOS: goos, GOARCH: goarch}, nil
+}
+
+// platformList is the output of `go tool dist list`.
+//
+//go:embed platforms.txt
+var platformList string
+
+// KnownPlatforms returns every platform supported by the go toolchain.
+var KnownPlatforms = sync.OnceValue(func() []Platform {
+	var platforms []Platform
+	for _, line := range strings.Fields(platformList) {
+		p, err := ParsePlatform(line)
+		if err != nil {
+			panic(err) // platforms.txt is static, so this is a programmer error
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms
+})
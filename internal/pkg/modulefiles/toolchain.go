@@ -0,0 +1,151 @@
+package modulefiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"go/version"
+	"strconv"
+	"strings"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+	"golang.org/x/mod/modfile"
+)
+
+// localGoVersion is the go version that helpmakego was built with.
+//
+// It is the best guess we have at the version of the local go toolchain.
+var localGoVersion = build.Default.ReleaseTags[len(build.Default.ReleaseTags)-1]
+
+// normalizeGoVersion converts a go version as written in go.mod ("1.23.4") or by the
+// go command ("go1.23.4") into the format understood by [version].
+//
+// Versions without a go1.N language version (such as "1" or "2.0") are valid to
+// [version], but not versions of a toolchain that exists, so they are rejected.
+func normalizeGoVersion(v string) (string, error) {
+	if !strings.HasPrefix(v, "go") {
+		v = "go" + v
+	}
+	if !version.IsValid(v) || !strings.HasPrefix(version.Lang(v), "go1.") {
+		return "", fmt.Errorf("invalid go version %q", strings.TrimPrefix(v, "go"))
+	}
+	return v, nil
+}
+
+// releaseTags returns the release tags ("go1.1" through "go1.N") that a go toolchain of
+// version goVersion satisfies.
+func releaseTags(goVersion string) []string {
+	minor, err := strconv.Atoi(strings.TrimPrefix(version.Lang(goVersion), "go1."))
+	if err != nil {
+		panic(fmt.Sprintf("invalid go version %q", goVersion)) // goVersion has been normalized
+	}
+	tags := make([]string, minor)
+	for i := range tags {
+		tags[i] = "go1." + strconv.Itoa(i+1)
+	}
+	return tags
+}
+
+// resolveGoVersion returns the version of the go toolchain that the go command would
+// select to build the package at root, when the local toolchain has version local.
+//
+// The selection follows https://go.dev/doc/toolchain: GOTOOLCHAIN picks a default
+// toolchain, which is upgraded to the toolchain required by go.work (or go.mod) unless
+// GOTOOLCHAIN forbids switching toolchains.
+//
+// When local is "", the local toolchain is unknown and the version required by go.work
+// (or go.mod) is selected in its place.
+func (c Config) resolveGoVersion(ctx context.Context, root string, goWork bool, modules *modules, local string) (string, error) {
+	if c.GoVersion != "" {
+		return normalizeGoVersion(c.GoVersion)
+	}
+
+	canSwitch := true
+	switch name, suffix, _ := strings.Cut(c.GOTOOLCHAIN, "+"); {
+	case c.GOTOOLCHAIN == "", name == "auto", name == "path":
+	case suffix == "auto" || suffix == "path":
+		// "local+auto" switches from the local toolchain, like "auto".
+		if name != "local" {
+			v, err := normalizeGoVersion(name)
+			if err != nil {
+				return "", fmt.Errorf("invalid GOTOOLCHAIN %q: %w", c.GOTOOLCHAIN, err)
+			}
+			local = v
+		}
+	case name == "local":
+		canSwitch = false
+	case suffix == "":
+		v, err := normalizeGoVersion(name)
+		if err != nil {
+			return "", fmt.Errorf("invalid GOTOOLCHAIN %q: %w", c.GOTOOLCHAIN, err)
+		}
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid GOTOOLCHAIN %q", c.GOTOOLCHAIN)
+	}
+	if !canSwitch && local != "" {
+		return local, nil
+	}
+
+	required, err := modules.requiredGoVersion(ctx, root, goWork)
+	if err != nil {
+		return "", err
+	}
+	if local == "" {
+		return required, nil
+	}
+	return newerGoVersion(local, required), nil
+}
+
+// requiredGoVersion returns the minimum go toolchain version required to build the
+// package at root, as described by the go and toolchain lines of the governing go.work or
+// go.mod.
+func (m *modules) requiredGoVersion(ctx context.Context, root string, goWork bool) (string, error) {
+	var goLine *modfile.Go
+	var toolchainLine *modfile.Toolchain
+	var source string
+
+	if goWork {
+		work, err := m.findGoWork(ctx, root)
+		switch {
+		case err == nil:
+			goLine, toolchainLine, source = work.file.Go, work.file.Toolchain, work.rootDir
+		case !errors.Is(err, errNoGoWorkFound):
+			return "", err
+		}
+	}
+	if source == "" {
+		mod, err := m.findGoMod(ctx, root)
+		if err != nil {
+			return "", err
+		}
+		goLine, toolchainLine, source = mod.file.Go, mod.file.Toolchain, mod.rootDir
+	}
+
+	// A module without a go line is assumed to be go 1.16.
+	required := "go1.16"
+	if goLine != nil {
+		v, err := normalizeGoVersion(goLine.Version)
+		if err != nil {
+			return "", fmt.Errorf("invalid go line in %s: %w", source, err)
+		}
+		required = v
+	}
+	if toolchainLine != nil && toolchainLine.Name != "default" {
+		if v, err := normalizeGoVersion(toolchainLine.Name); err == nil {
+			required = newerGoVersion(required, v)
+		} else {
+			log.Warn(ctx, "ignoring invalid toolchain line", log.Attr("source", source))
+		}
+	}
+	return required, nil
+}
+
+// newerGoVersion returns the newer of the normalized go versions a and b.
+func newerGoVersion(a, b string) string {
+	if version.Compare(a, b) < 0 {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,84 @@
+package modulefiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/version"
+	"os"
+	"path/filepath"
+
+	"github.com/iwahbe/helpmakego/internal/pkg/log"
+)
+
+// vendorDir returns the vendor directory that the go command would build the package at
+// root from, or "" if the build doesn't use vendoring.
+//
+// See https://go.dev/ref/mod#vendoring. In short: a vendor directory is used if -mod=vendor
+// is set, or if it exists and the governing go.work (go 1.22+) or go.mod (go 1.14+) is
+// new enough to default to vendoring.
+func (m *modules) vendorDir(ctx context.Context, root string, goWork bool, config Config) (string, error) {
+	if config.Vendor != nil && !*config.Vendor {
+		return "", nil
+	}
+
+	// A go.mod or go.work without a go line is assumed to be go 1.16.
+	dir, goLine, minVersion := "", "1.16", ""
+	if goWork {
+		work, err := m.findGoWork(ctx, root)
+		switch {
+		case err == nil:
+			dir, minVersion = filepath.Join(work.rootDir, "vendor"), "go1.22"
+			if work.file.Go != nil {
+				goLine = work.file.Go.Version
+			}
+		case !errors.Is(err, errNoGoWorkFound):
+			return "", err
+		}
+	}
+	if dir == "" {
+		mod, err := m.findGoMod(ctx, root)
+		if err != nil {
+			return "", err
+		}
+		dir, minVersion = filepath.Join(mod.rootDir, "vendor"), "go1.14"
+		if mod.file.Go != nil {
+			goLine = mod.file.Go.Version
+		}
+	}
+
+	info, err := os.Stat(dir)
+	exists := err == nil && info.IsDir()
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("could not check for vendor directory: %w", err)
+	}
+
+	// -mod=vendor was explicitly requested.
+	if config.Vendor != nil {
+		if !exists {
+			return "", fmt.Errorf("-mod=vendor is set, but %s does not exist", dir)
+		}
+		return dir, nil
+	}
+
+	if !exists {
+		return "", nil
+	}
+	if v, err := normalizeGoVersion(goLine); err != nil || version.Compare(v, minVersion) < 0 {
+		log.Debug(ctx, "ignoring vendor directory: go version too old", log.Attr("vendor", dir))
+		return "", nil
+	}
+	log.Info(ctx, "using vendor directory", log.Attr("vendor", dir))
+	return dir, nil
+}
+
+// addVendorFiles adds the files describing the vendor directory at dir.
+func addVendorFiles(dir string, files map[string]struct{}) error {
+	modulesTxt := filepath.Join(dir, "modules.txt")
+	if _, err := os.Stat(modulesTxt); err == nil {
+		files[modulesTxt] = struct{}{}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("could not check if vendor/modules.txt exists: %w", err)
+	}
+	return nil
+}
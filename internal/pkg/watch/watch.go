@@ -0,0 +1,12 @@
+// Package watch reports changes to a set of files, and to the entries of a set of
+// directories.
+package watch
+
+import "strings"
+
+// isIgnoredName reports whether a directory entry named name is ignored when watching
+// the entries of a directory. Like the go command, such names are not part of packages,
+// and editors use them for swap and lock files.
+func isIgnoredName(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
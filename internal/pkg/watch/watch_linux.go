@@ -0,0 +1,263 @@
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Watcher reports changes to a set of files, and to the entries of a set of directories.
+//
+// Files are watched through their parent directory, so a file that is replaced (as
+// editors do when saving atomically) or deleted and created again is still watched.
+type Watcher struct {
+	fd       int      // The inotify instance
+	file     *os.File // fd, for reads through the runtime poller
+	events   chan string
+	done     chan struct{}
+	readOnce sync.Once // Starts reading events into events
+
+	mu      sync.Mutex
+	watches map[int32]*dirWatch // By watch descriptor
+	dirs    map[string]int32    // Watch descriptors by directory
+}
+
+// dirWatch is a watched directory.
+type dirWatch struct {
+	dir string
+	// files holds the names of the files in dir to report.
+	files map[string]struct{}
+	// entries reports every entry added to or removed from dir.
+	entries bool
+}
+
+// bufSize is the size of a buffer that can hold many inotify events.
+const bufSize = 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)
+
+// mask selects the inotify events that change the content of a file, or the entries of a
+// directory.
+const mask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+// NewWatcher returns a Watcher that watches nothing, until [Watcher.Watch] is called.
+func NewWatcher() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+	w := &Watcher{
+		// The file is non-blocking, so reads go through the runtime poller and Close
+		// interrupts a pending read.
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		events:  make(chan string, 64),
+		done:    make(chan struct{}),
+		watches: map[int32]*dirWatch{},
+		dirs:    map[string]int32{},
+	}
+	return w, nil
+}
+
+// Watch replaces the set of watched paths.
+//
+// Each of files is reported when its content changes, or when it is created, deleted or
+// replaced. Each of dirs is reported when it is deleted, and each entry added to or
+// removed from it is reported, except for entries that begin with "." or "_".
+//
+// Paths that can't be watched (such as files in directories that no longer exist) are
+// reported as errors, but don't stop the remaining paths from being watched.
+func (w *Watcher) Watch(files, dirs []string) error {
+	wanted := map[string]*dirWatch{}
+	get := func(dir string) *dirWatch {
+		d, ok := wanted[dir]
+		if !ok {
+			d = &dirWatch{dir: dir, files: map[string]struct{}{}}
+			wanted[dir] = d
+		}
+		return d
+	}
+	for _, f := range files {
+		f = filepath.Clean(f)
+		get(filepath.Dir(f)).files[filepath.Base(f)] = struct{}{}
+	}
+	for _, dir := range dirs {
+		get(filepath.Clean(dir)).entries = true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var errs []error
+	watches := make(map[int32]*dirWatch, len(wanted))
+	byDir := make(map[string]int32, len(wanted))
+	for dir, d := range wanted {
+		wd, err := syscall.InotifyAddWatch(w.fd, dir, mask)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not watch %s: %w", dir, err))
+			continue
+		}
+		watches[int32(wd)] = d
+		byDir[dir] = int32(wd)
+	}
+	for wd := range w.watches {
+		if _, ok := watches[wd]; !ok {
+			// The directory may already be gone, which removes the watch.
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+		}
+	}
+	w.watches, w.dirs = watches, byDir
+	return errors.Join(errs...)
+}
+
+// Add adds files and dirs to the set of watched paths, as [Watcher.Watch] watches them.
+//
+// Only directories that aren't watched yet are added to the inotify instance, so adding
+// paths that are already watched is cheap.
+func (w *Watcher) Add(files, dirs []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var errs []error
+	get := func(dir string) *dirWatch {
+		dir = filepath.Clean(dir)
+		if wd, ok := w.dirs[dir]; ok {
+			return w.watches[wd]
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, dir, mask)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not watch %s: %w", dir, err))
+			return nil
+		}
+		// A directory reached by another path (such as through a symlink) shares its
+		// watch descriptor.
+		d, ok := w.watches[int32(wd)]
+		if !ok {
+			d = &dirWatch{dir: dir, files: map[string]struct{}{}}
+			w.watches[int32(wd)] = d
+		}
+		w.dirs[dir] = int32(wd)
+		return d
+	}
+	for _, f := range files {
+		f = filepath.Clean(f)
+		if d := get(filepath.Dir(f)); d != nil {
+			d.files[filepath.Base(f)] = struct{}{}
+		}
+	}
+	for _, dir := range dirs {
+		if d := get(dir); d != nil {
+			d.entries = true
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Events returns the paths that changed, one event at a time. An empty path reports that
+// events were lost, so any watched path may have changed.
+//
+// The channel is closed when the Watcher is closed.
+func (w *Watcher) Events() <-chan string {
+	w.readOnce.Do(func() { go w.read() })
+	return w.events
+}
+
+// Pending returns the paths that changed since the last call to Pending, without waiting
+// for more changes, in the format of [Watcher.Events]. Every change made before Pending is
+// called is reported.
+//
+// Pending reads changes itself, so it can't be used together with Events.
+func (w *Watcher) Pending() []string {
+	var paths []string
+	buf := make([]byte, bufSize)
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		switch {
+		case err == syscall.EINTR:
+			continue
+		case err != nil || n <= 0:
+			// EAGAIN once every queued event is read, or EBADF once the Watcher is
+			// closed.
+			return paths
+		}
+		paths = append(paths, w.parse(buf[:n])...)
+	}
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+	}
+	close(w.done)
+	return w.file.Close()
+}
+
+// read reads inotify events until the Watcher is closed.
+func (w *Watcher) read() {
+	defer close(w.events)
+	buf := make([]byte, bufSize)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			// Reads only fail once the Watcher is closed.
+			return
+		}
+		for _, path := range w.parse(buf[:n]) {
+			select {
+			case w.events <- path:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// parse returns the paths reported by the inotify events in buf.
+func (w *Watcher) parse(buf []byte) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var paths []string
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := syscall.SizeofInotifyEvent + int(event.Len)
+		name := string(bytes.TrimRight(buf[syscall.SizeofInotifyEvent:end], "\x00"))
+		buf = buf[end:]
+
+		if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			paths = append(paths, "")
+			continue
+		}
+		d, ok := w.watches[event.Wd]
+		if !ok {
+			continue
+		}
+		switch {
+		case event.Mask&syscall.IN_IGNORED != 0:
+			// The directory was deleted, or the watch was removed.
+			delete(w.watches, event.Wd)
+			if w.dirs[d.dir] == event.Wd {
+				delete(w.dirs, d.dir)
+			}
+		case event.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+			paths = append(paths, d.dir)
+		case name == "":
+		case d.entries && !isIgnoredName(name) &&
+			event.Mask&(syscall.IN_CREATE|syscall.IN_DELETE|syscall.IN_MOVED_FROM|syscall.IN_MOVED_TO) != 0:
+			paths = append(paths, filepath.Join(d.dir, name))
+		default:
+			if _, ok := d.files[name]; ok {
+				paths = append(paths, filepath.Join(d.dir, name))
+			}
+		}
+	}
+	return paths
+}
@@ -0,0 +1,131 @@
+package watch
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	write := func(name, content string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(path(name)), 0755))
+		require.NoError(t, os.WriteFile(path(name), []byte(content), 0644))
+	}
+	write("pkg/main.go", "package main")
+	write("pkg/other.txt", "")
+	write("static/app.js", "")
+
+	require.NoError(t, os.Mkdir(path("sync"), 0755))
+	var markers []string
+	for i := range 10 {
+		markers = append(markers, path(fmt.Sprintf("sync/%d", i)))
+	}
+
+	w, err := NewWatcher()
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, w.Close()) })
+	watch := func(files, dirs []string) error {
+		return w.Watch(append(files, markers...), dirs)
+	}
+	require.NoError(t, watch([]string{path("pkg/main.go"), path("static/app.js")}, []string{path("pkg")}))
+
+	// changes returns the paths reported since the last call, by creating a marker file
+	// and collecting events until it is reported.
+	changes := func() []string {
+		t.Helper()
+		marker := markers[0]
+		markers = markers[1:]
+		require.NoError(t, os.WriteFile(marker, nil, 0644))
+		seen := map[string]struct{}{}
+		for {
+			select {
+			case event := <-w.Events():
+				if event == marker {
+					return slices.Sorted(maps.Keys(seen))
+				}
+				if filepath.Dir(event) != path("sync") {
+					seen[event] = struct{}{}
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for an event")
+			}
+		}
+	}
+
+	write("pkg/main.go", "package main // changed")
+	assert.Equal(t, []string{path("pkg/main.go")}, changes())
+
+	// Files in the watched directory are only reported when they are added or removed.
+	write("pkg/other.txt", "changed")
+	write("pkg/.main.go.swp", "")
+	write("pkg/new.go", "package main")
+	assert.Equal(t, []string{path("pkg/new.go")}, changes())
+
+	// Files in the parent directory of a watched file are not reported.
+	write("static/other.js", "")
+	assert.Empty(t, changes())
+
+	// A file that is replaced is still watched.
+	write("static/app.js.tmp", "replaced")
+	require.NoError(t, os.Rename(path("static/app.js.tmp"), path("static/app.js")))
+	assert.Equal(t, []string{path("static/app.js")}, changes())
+	write("static/app.js", "changed again")
+	assert.Equal(t, []string{path("static/app.js")}, changes())
+
+	// Watching a new set stops watching the old set.
+	require.NoError(t, watch([]string{path("static/app.js")}, nil))
+	write("pkg/main.go", "package main // changed again")
+	require.NoError(t, os.Remove(path("pkg/new.go")))
+	assert.Empty(t, changes())
+
+	assert.Error(t, w.Watch([]string{path("missing/file.go")}, nil))
+}
+
+func TestWatcherPending(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	write := func(name, content string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(path(name)), 0755))
+		require.NoError(t, os.WriteFile(path(name), []byte(content), 0644))
+	}
+	write("mod/go.mod", "module example.com/m")
+	write("mod/pkg/main.go", "package main")
+
+	w, err := NewWatcher()
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, w.Close()) })
+	// pending returns the paths reported by Pending, without repeats: writing a file
+	// reports it once when it is modified, and again when it is closed.
+	pending := func() []string { return slices.Compact(slices.Sorted(slices.Values(w.Pending()))) }
+	require.NoError(t, w.Add([]string{path("mod/go.mod")}, nil))
+	assert.Empty(t, pending())
+
+	// Changes are reported as soon as they are made, once each.
+	write("mod/go.mod", "module example.com/changed")
+	assert.Equal(t, []string{path("mod/go.mod")}, pending())
+	assert.Empty(t, pending())
+
+	// Adding paths keeps watching the paths added before.
+	require.NoError(t, w.Add([]string{path("mod/go.mod")}, []string{path("mod/pkg")}))
+	write("mod/pkg/new.go", "package main")
+	write("mod/go.mod", "module example.com/m")
+	write("mod/other.txt", "")
+	assert.Equal(t, []string{path("mod/go.mod"), path("mod/pkg/new.go")}, pending())
+
+	assert.Error(t, w.Add(nil, []string{path("missing")}))
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// Watcher reports changes to a set of files, and to the entries of a set of directories.
+//
+// Watching is only supported on linux.
+type Watcher struct{}
+
+// NewWatcher returns an error: watching is only supported on linux.
+func NewWatcher() (*Watcher, error) {
+	return nil, errors.New("watching files is only supported on linux")
+}
+
+func (w *Watcher) Watch(files, dirs []string) error { return nil }
+
+func (w *Watcher) Add(files, dirs []string) error { return nil }
+
+func (w *Watcher) Events() <-chan string { return nil }
+
+func (w *Watcher) Pending() []string { return nil }
+
+func (w *Watcher) Close() error { return nil }
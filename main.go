@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -9,6 +10,13 @@ import (
 
 func main() {
 	if err := cmd.Root().Execute(); err != nil {
+		var exitErr *cmd.ExitError
+		if errors.As(err, &exitErr) {
+			if exitErr.Err != nil {
+				fmt.Fprintf(os.Stderr, "helpmakego: %s\n", exitErr.Err)
+			}
+			os.Exit(exitErr.Code)
+		}
 		fmt.Printf("%s", err)
 		os.Exit(1)
 	}